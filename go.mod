@@ -3,8 +3,14 @@ module github.com/grafana/simple-datasource-backend
 go 1.14
 
 require (
-	github.com/grafana/grafana-plugin-sdk-go v0.65.0
-	github.com/hashicorp/consul/api v1.7.0
-	github.com/hashicorp/consul/sdk v0.6.0
+	github.com/BurntSushi/toml v0.3.1
+	github.com/grafana/grafana-plugin-sdk-go v0.114.0
+	github.com/hashicorp/consul/api v1.12.0
+	github.com/hashicorp/consul/sdk v0.8.0
+	github.com/hashicorp/go-msgpack v0.5.3
+	github.com/hashicorp/hcl v1.0.0
 	github.com/sergi/go-diff v1.1.0
+	github.com/tidwall/gjson v1.6.8
+	go.etcd.io/bbolt v1.3.6
+	sigs.k8s.io/yaml v1.2.0
 )
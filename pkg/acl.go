@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/hashicorp/consul/api"
+)
+
+// queryACL returns the ACL tokens (type acltokens), policies (type aclpolicies), roles (type aclroles) or
+// auth methods (type aclauthmethods). Tables contain a row per entry. Time series contain the seconds until
+// the expiration of each token or the number of tokens per policy, role or auth method.
+// The secret IDs of the tokens are never returned.
+func queryACL(ctx context.Context, consul *api.Client, query queryModel, opts *api.QueryOptions) backend.DataResponse {
+	log.DefaultLogger.Debug("queryACL", "query", query)
+
+	opts = opts.WithContext(ctx)
+	tokens, _, err := consul.ACL().TokenList(opts)
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error consul acl tokens: %v", err)}
+	}
+
+	switch query.Type {
+	case "acltokens":
+		return queryACLTokens(consul, query, tokens, opts)
+	case "aclpolicies":
+		return queryACLPolicies(consul, query, tokens, opts)
+	case "aclroles":
+		return queryACLRoles(consul, query, tokens, opts)
+	case "aclauthmethods":
+		return queryACLAuthMethods(consul, query, tokens, opts)
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown query type: %s", query.Type)}
+}
+
+// queryACLTokens returns the tokens bound to the target policy name or ID, directly or through a role.
+// If expiresWithin is set only tokens expiring within this duration are returned.
+func queryACLTokens(consul *api.Client, query queryModel, tokens []*api.ACLTokenListEntry, opts *api.QueryOptions) backend.DataResponse {
+	if query.ExpiresWithin != "" {
+		within, err := time.ParseDuration(query.ExpiresWithin)
+		if err != nil {
+			return backend.DataResponse{Error: fmt.Errorf("error parsing expires within %s: %v", query.ExpiresWithin, err)}
+		}
+		deadline := time.Now().Add(within)
+		var filtered []*api.ACLTokenListEntry
+		for _, token := range tokens {
+			if token.ExpirationTime != nil && !token.ExpirationTime.After(deadline) {
+				filtered = append(filtered, token)
+			}
+		}
+		tokens = filtered
+	}
+
+	if query.Target != "" {
+		roles, _, err := consul.ACL().RoleList(opts)
+		if err != nil {
+			return backend.DataResponse{Error: fmt.Errorf("error consul acl roles: %v", err)}
+		}
+		roleHasPolicy := map[string]bool{}
+		for _, role := range roles {
+			for _, policy := range role.Policies {
+				if policy.ID == query.Target || policy.Name == query.Target {
+					roleHasPolicy[role.ID] = true
+				}
+			}
+		}
+
+		var filtered []*api.ACLTokenListEntry
+		for _, token := range tokens {
+			if tokenHasPolicy(token, query.Target, roleHasPolicy) {
+				filtered = append(filtered, token)
+			}
+		}
+		tokens = filtered
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].AccessorID < tokens[j].AccessorID
+	})
+
+	switch query.Format {
+	case "", "timeseries":
+		return generateDataResponseFromACLTokens(tokens)
+	case "table":
+		return generateTableFromACLTokens(tokens)
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown format %s", query.Format)}
+}
+
+// tokenHasPolicy returns true if the token is bound to the policy with the name or ID directly or through
+// one of the roles in roleHasPolicy
+func tokenHasPolicy(token *api.ACLTokenListEntry, policy string, roleHasPolicy map[string]bool) bool {
+	for _, link := range token.Policies {
+		if link.ID == policy || link.Name == policy {
+			return true
+		}
+	}
+	for _, link := range token.Roles {
+		if roleHasPolicy[link.ID] {
+			return true
+		}
+	}
+	return false
+}
+
+// generateDataResponseFromACLTokens returns a series per expiring token with the seconds until its expiration
+func generateDataResponseFromACLTokens(tokens []*api.ACLTokenListEntry) backend.DataResponse {
+	response := backend.DataResponse{}
+	now := time.Now()
+	for _, token := range tokens {
+		if token.ExpirationTime == nil {
+			continue
+		}
+		labels := data.Labels{"accessorID": token.AccessorID, "description": token.Description}
+		response.Frames = append(response.Frames, data.NewFrame(token.AccessorID,
+			data.NewField("time", nil, []time.Time{now}),
+			data.NewField("values", labels, []float64{token.ExpirationTime.Sub(now).Seconds()}),
+		))
+	}
+	return response
+}
+
+func generateTableFromACLTokens(tokens []*api.ACLTokenListEntry) backend.DataResponse {
+	frame := data.NewFrame("acltokens",
+		data.NewField("accessorID", nil, []string{}),
+		data.NewField("description", nil, []string{}),
+		data.NewField("policies", nil, []string{}),
+		data.NewField("roles", nil, []string{}),
+		data.NewField("serviceIdentities", nil, []string{}),
+		data.NewField("nodeIdentities", nil, []string{}),
+		data.NewField("authMethod", nil, []string{}),
+		data.NewField("local", nil, []bool{}),
+		data.NewField("createTime", nil, []time.Time{}),
+		data.NewField("expirationTime", nil, []*time.Time{}),
+		data.NewField("expiresIn", nil, []*float64{}),
+	)
+	frame.Fields[10].Config = &data.FieldConfig{Unit: "s"}
+	now := time.Now()
+	for _, token := range tokens {
+		var policies, roles, serviceIdentities, nodeIdentities []string
+		for _, link := range token.Policies {
+			policies = append(policies, link.Name)
+		}
+		for _, link := range token.Roles {
+			roles = append(roles, link.Name)
+		}
+		for _, identity := range token.ServiceIdentities {
+			serviceIdentities = append(serviceIdentities, identity.ServiceName)
+		}
+		for _, identity := range token.NodeIdentities {
+			nodeIdentities = append(nodeIdentities, identity.NodeName)
+		}
+
+		var expiresIn *float64
+		if token.ExpirationTime != nil {
+			seconds := token.ExpirationTime.Sub(now).Seconds()
+			expiresIn = &seconds
+		}
+		frame.AppendRow(token.AccessorID, token.Description, joinSorted(policies), joinSorted(roles),
+			joinSorted(serviceIdentities), joinSorted(nodeIdentities), token.AuthMethod, token.Local,
+			token.CreateTime, token.ExpirationTime, expiresIn)
+	}
+	return backend.DataResponse{Frames: []*data.Frame{frame}}
+}
+
+func queryACLPolicies(consul *api.Client, query queryModel, tokens []*api.ACLTokenListEntry, opts *api.QueryOptions) backend.DataResponse {
+	policies, _, err := consul.ACL().PolicyList(opts)
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error consul acl policies: %v", err)}
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Name < policies[j].Name
+	})
+
+	switch query.Format {
+	case "", "timeseries":
+		counts := map[string]float64{}
+		for _, token := range tokens {
+			for _, link := range token.Policies {
+				counts[link.ID]++
+			}
+		}
+		response := backend.DataResponse{}
+		now := time.Now()
+		for _, policy := range policies {
+			response.Frames = append(response.Frames, aclTokenCountFrame(now, "policy", policy.Name, counts[policy.ID]))
+		}
+		return response
+	case "table":
+		frame := data.NewFrame("aclpolicies",
+			data.NewField("id", nil, []string{}),
+			data.NewField("name", nil, []string{}),
+			data.NewField("description", nil, []string{}),
+			data.NewField("datacenters", nil, []string{}),
+		)
+		for _, policy := range policies {
+			frame.AppendRow(policy.ID, policy.Name, policy.Description, joinSorted(policy.Datacenters))
+		}
+		return backend.DataResponse{Frames: []*data.Frame{frame}}
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown format %s", query.Format)}
+}
+
+func queryACLRoles(consul *api.Client, query queryModel, tokens []*api.ACLTokenListEntry, opts *api.QueryOptions) backend.DataResponse {
+	roles, _, err := consul.ACL().RoleList(opts)
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error consul acl roles: %v", err)}
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+
+	switch query.Format {
+	case "", "timeseries":
+		counts := map[string]float64{}
+		for _, token := range tokens {
+			for _, link := range token.Roles {
+				counts[link.ID]++
+			}
+		}
+		response := backend.DataResponse{}
+		now := time.Now()
+		for _, role := range roles {
+			response.Frames = append(response.Frames, aclTokenCountFrame(now, "role", role.Name, counts[role.ID]))
+		}
+		return response
+	case "table":
+		frame := data.NewFrame("aclroles",
+			data.NewField("id", nil, []string{}),
+			data.NewField("name", nil, []string{}),
+			data.NewField("description", nil, []string{}),
+			data.NewField("policies", nil, []string{}),
+			data.NewField("serviceIdentities", nil, []string{}),
+			data.NewField("nodeIdentities", nil, []string{}),
+		)
+		for _, role := range roles {
+			var policies, serviceIdentities, nodeIdentities []string
+			for _, link := range role.Policies {
+				policies = append(policies, link.Name)
+			}
+			for _, identity := range role.ServiceIdentities {
+				serviceIdentities = append(serviceIdentities, identity.ServiceName)
+			}
+			for _, identity := range role.NodeIdentities {
+				nodeIdentities = append(nodeIdentities, identity.NodeName)
+			}
+			frame.AppendRow(role.ID, role.Name, role.Description, joinSorted(policies),
+				joinSorted(serviceIdentities), joinSorted(nodeIdentities))
+		}
+		return backend.DataResponse{Frames: []*data.Frame{frame}}
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown format %s", query.Format)}
+}
+
+func queryACLAuthMethods(consul *api.Client, query queryModel, tokens []*api.ACLTokenListEntry, opts *api.QueryOptions) backend.DataResponse {
+	methods, _, err := consul.ACL().AuthMethodList(opts)
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error consul acl auth methods: %v", err)}
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].Name < methods[j].Name
+	})
+
+	switch query.Format {
+	case "", "timeseries":
+		counts := map[string]float64{}
+		for _, token := range tokens {
+			counts[token.AuthMethod]++
+		}
+		response := backend.DataResponse{}
+		now := time.Now()
+		for _, method := range methods {
+			response.Frames = append(response.Frames, aclTokenCountFrame(now, "authMethod", method.Name, counts[method.Name]))
+		}
+		return response
+	case "table":
+		frame := data.NewFrame("aclauthmethods",
+			data.NewField("name", nil, []string{}),
+			data.NewField("type", nil, []string{}),
+			data.NewField("displayName", nil, []string{}),
+			data.NewField("description", nil, []string{}),
+			data.NewField("maxTokenTTL", nil, []float64{}),
+			data.NewField("tokenLocality", nil, []string{}),
+		)
+		frame.Fields[4].Config = &data.FieldConfig{Unit: "s"}
+		for _, method := range methods {
+			frame.AppendRow(method.Name, method.Type, method.DisplayName, method.Description,
+				method.MaxTokenTTL.Seconds(), method.TokenLocality)
+		}
+		return backend.DataResponse{Frames: []*data.Frame{frame}}
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown format %s", query.Format)}
+}
+
+// aclTokenCountFrame returns a series with the number of tokens bound to a policy, role or auth method
+func aclTokenCountFrame(now time.Time, label, name string, count float64) *data.Frame {
+	return data.NewFrame(name,
+		data.NewField("time", nil, []time.Time{now}),
+		data.NewField("values", data.Labels{label: name}, []float64{count}),
+	)
+}
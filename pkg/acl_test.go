@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/hashicorp/consul/sdk/testutil/retry"
+)
+
+func TestQueryACL(t *testing.T) {
+	srv, err := testutil.NewTestServerConfigT(&testing.T{}, func(c *testutil.TestServerConfig) {
+		c.Datacenter = "default"
+		c.ACL.Enabled = true
+		c.ACL.DefaultPolicy = "deny"
+		c.ACL.Tokens.Master = "root"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+
+	consul, err := newConsul(srv.HTTPAddr, "root")
+	if err != nil {
+		t.Fatalf("could not create consul client: %v", err)
+	}
+
+	// the ACL system starts in legacy mode until the servers are upgraded to the new ACLs
+	var policy *api.ACLPolicy
+	retry.Run(t, func(r *retry.R) {
+		policy, _, err = consul.ACL().PolicyCreate(&api.ACLPolicy{Name: "kv-read", Rules: `key_prefix "" { policy = "read" }`}, nil)
+		if err != nil {
+			r.Fatalf("could not create policy: %v", err)
+		}
+	})
+	role, _, err := consul.ACL().RoleCreate(&api.ACLRole{Name: "operators", Policies: []*api.ACLRolePolicyLink{{Name: "global-management"}}}, nil)
+	if err != nil {
+		t.Fatalf("could not create role: %v", err)
+	}
+	expiring, _, err := consul.ACL().TokenCreate(&api.ACLToken{
+		Description:   "ci",
+		Policies:      []*api.ACLTokenPolicyLink{{ID: policy.ID}},
+		ExpirationTTL: 24 * time.Hour,
+	}, nil)
+	if err != nil {
+		t.Fatalf("could not create token: %v", err)
+	}
+	operator, _, err := consul.ACL().TokenCreate(&api.ACLToken{Description: "operator", Roles: []*api.ACLTokenRoleLink{{ID: role.ID}}}, nil)
+	if err != nil {
+		t.Fatalf("could not create token: %v", err)
+	}
+
+	instance, err := newInstanceSettings(consul, jsonData{})
+	if err != nil {
+		t.Fatalf("could not create instance: %v", err)
+	}
+
+	response := query(context.TODO(), instance, map[string]queryModel{
+		"tokens":      {Format: "table", Type: "acltokens"},
+		"expiring":    {Format: "table", Type: "acltokens", ExpiresWithin: "720h"},
+		"management":  {Format: "table", Type: "acltokens", Target: "global-management"},
+		"timeseries":  {Format: "timeseries", Type: "acltokens"},
+		"policies":    {Format: "timeseries", Type: "aclpolicies"},
+		"roles":       {Format: "table", Type: "aclroles"},
+		"authmethods": {Format: "table", Type: "aclauthmethods"},
+		"invalid":     {Format: "table", Type: "acltokens", ExpiresWithin: "month"},
+	})
+
+	t.Run("no secrets", func(t *testing.T) {
+		secrets := map[string]bool{"root": true, expiring.SecretID: true, operator.SecretID: true}
+		for refID, res := range response.Responses {
+			for _, frame := range res.Frames {
+				for _, field := range frame.Fields {
+					for i := 0; i < field.Len(); i++ {
+						if value, ok := field.At(i).(string); ok && secrets[value] {
+							t.Errorf("expected no secret IDs, got one in %s field %s", refID, field.Name)
+						}
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("tokens", func(t *testing.T) {
+		res := response.Responses["tokens"]
+		if res.Error != nil || len(res.Frames) != 1 || res.Frames[0].Rows() < 3 {
+			t.Fatalf("expected the master, anonymous and created tokens, got error %v", res.Error)
+		}
+	})
+
+	// the ACL types need a server with ACLs, so their golden cases are not part of TestQuery
+	t.Run("golden", func(t *testing.T) {
+		golden := backend.NewQueryDataResponse()
+		for _, refID := range []string{"tokens", "policies", "roles", "authmethods"} {
+			golden.Responses[refID] = response.Responses[refID]
+		}
+		checkGolden(t, golden, "acl.json")
+	})
+
+	t.Run("expiring", func(t *testing.T) {
+		res := response.Responses["expiring"]
+		if res.Error != nil || len(res.Frames) != 1 || res.Frames[0].Rows() != 1 {
+			t.Fatalf("expected one expiring token, got error %v", res.Error)
+		}
+		row := res.Frames[0].RowCopy(0)
+		if row[0] != expiring.AccessorID || row[1] != "ci" || row[2] != "kv-read" || row[9] == nil {
+			t.Errorf("expected the expiring ci token, got %v", row)
+		}
+		if expiresIn, ok := row[10].(*float64); !ok || expiresIn == nil || *expiresIn <= 0 || *expiresIn > 24*60*60 {
+			t.Errorf("expected the token to expire within a day, got %v", row[10])
+		}
+	})
+
+	t.Run("management", func(t *testing.T) {
+		res := response.Responses["management"]
+		if res.Error != nil || len(res.Frames) != 1 {
+			t.Fatalf("expected a table, got error %v", res.Error)
+		}
+		var accessors []string
+		for i := 0; i < res.Frames[0].Rows(); i++ {
+			accessors = append(accessors, res.Frames[0].At(0, i).(string))
+		}
+		if !containsAll(accessors, []string{operator.AccessorID}) || containsAll(accessors, []string{expiring.AccessorID}) {
+			t.Errorf("expected the operator token bound through its role and not the ci token, got %v", accessors)
+		}
+	})
+
+	t.Run("timeseries", func(t *testing.T) {
+		res := response.Responses["timeseries"]
+		if res.Error != nil || len(res.Frames) != 1 {
+			t.Fatalf("expected a series for the expiring token, got error %v", res.Error)
+		}
+		if res.Frames[0].Fields[1].Labels["accessorID"] != expiring.AccessorID {
+			t.Errorf("expected the series of the ci token, got %v", res.Frames[0].Fields[1].Labels)
+		}
+	})
+
+	t.Run("policies", func(t *testing.T) {
+		res := response.Responses["policies"]
+		if res.Error != nil {
+			t.Fatalf("expected no error, got %v", res.Error)
+		}
+		counts := map[string]float64{}
+		for _, frame := range res.Frames {
+			counts[frame.Fields[1].Labels["policy"]] = frame.Fields[1].At(0).(float64)
+		}
+		if counts["kv-read"] != 1 || counts["global-management"] != 1 {
+			t.Errorf("expected one token per policy, got %v", counts)
+		}
+	})
+
+	t.Run("roles", func(t *testing.T) {
+		res := response.Responses["roles"]
+		if res.Error != nil || len(res.Frames) != 1 || res.Frames[0].Rows() != 1 {
+			t.Fatalf("expected one role, got error %v", res.Error)
+		}
+		row := res.Frames[0].RowCopy(0)
+		if row[1] != "operators" || row[3] != "global-management" {
+			t.Errorf("expected the operators role, got %v", row)
+		}
+	})
+
+	t.Run("authmethods", func(t *testing.T) {
+		res := response.Responses["authmethods"]
+		if res.Error != nil || len(res.Frames) != 1 || res.Frames[0].Rows() != 0 {
+			t.Errorf("expected an empty table, got error %v", res.Error)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if response.Responses["invalid"].Error == nil {
+			t.Errorf("expected an error for an invalid duration")
+		}
+	})
+}
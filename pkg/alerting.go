@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/hashicorp/consul/api"
+)
+
+// alertSeries is a numeric value of a query in alerting mode together with the labels identifying it
+type alertSeries struct {
+	labels data.Labels
+	value  float64
+}
+
+// queryAlerting executes a time series query in alerting mode. In contrast to the normal time series
+// queries, all values are numeric and labeled with their key, so alert rules can evaluate them:
+// get and tags return the values of the keys, strings are mapped to numbers via the value mappings,
+// keys returns 1 for every subkey.
+// The series are returned as a single wide frame or, if the series format is long, a long frame.
+func queryAlerting(ctx context.Context, consul *api.Client, query queryModel, concurrency int, opts *api.QueryOptions) backend.DataResponse {
+	log.DefaultLogger.Debug("queryAlerting", "query", query)
+
+	mappings, err := parseValueMappings(query.ValueMappings)
+	if err != nil {
+		return backend.DataResponse{Error: err}
+	}
+
+	target := strings.Replace(query.Target, "\\.", ".", -1)
+
+	var series []alertSeries
+	switch query.Type {
+	case "", "get":
+		target = strings.TrimSuffix(target, "/")
+		kv, _, err := consul.KV().Get(target, opts.WithContext(ctx))
+		if err != nil {
+			return backend.DataResponse{Error: fmt.Errorf("error consul get %s: %v", target, err)}
+		}
+		if kv != nil {
+			series, err = kvSeries(kv, query.ValueFormat, query.Path, mappings)
+			if err != nil {
+				return backend.DataResponse{Error: err}
+			}
+		}
+	case "keys":
+		if !strings.HasSuffix(target, "/") {
+			target += "/"
+		}
+		keys, _, err := consul.KV().Keys(target, "/", opts.WithContext(ctx))
+		if err != nil {
+			return backend.DataResponse{Error: fmt.Errorf("error consul keys %s: %v", target, err)}
+		}
+		for _, key := range keys {
+			series = append(series, alertSeries{labels: data.Labels{"key": key}, value: 1})
+		}
+	case "tags", "tagsrec":
+		if !strings.HasSuffix(target, "/") {
+			target += "/"
+		}
+		separator := "/"
+		if query.Type == "tagsrec" {
+			separator = ""
+		}
+		keys, _, err := consul.KV().Keys(target, separator, opts.WithContext(ctx))
+		if err != nil {
+			return backend.DataResponse{Error: fmt.Errorf("error consul keys %s: %v", target, err)}
+		}
+		kvs, err := fetchKVs(ctx, consul, keys, query.Type == "tagsrec", concurrency, opts)
+		if err != nil {
+			return backend.DataResponse{Error: fmt.Errorf("error consul get %s: %v", target, err)}
+		}
+		for _, key := range keys {
+			kv, ok := kvs[key]
+			if !ok {
+				continue
+			}
+			keySeries, err := kvSeries(kv, query.ValueFormat, query.Path, mappings)
+			if err != nil {
+				return backend.DataResponse{Error: err}
+			}
+			series = append(series, keySeries...)
+		}
+	default:
+		return backend.DataResponse{Error: fmt.Errorf("alerting is not supported for query type %s", query.Type)}
+	}
+
+	switch query.SeriesFormat {
+	case "", "wide":
+		return backend.DataResponse{Frames: []*data.Frame{wideSeriesFrame(target, series)}}
+	case "long":
+		return backend.DataResponse{Frames: []*data.Frame{longSeriesFrame(target, series)}}
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown series format %s", query.SeriesFormat)}
+}
+
+// kvSeries converts the values of kv to series labeled with the key. If the value is decoded to an array,
+// the series are additionally labeled with their index.
+func kvSeries(kv *api.KVPair, valueFormat, valuePath string, mappings map[string]float64) ([]alertSeries, error) {
+	values := []interface{}{string(kv.Value)}
+	if valueFormat != "" || valuePath != "" {
+		var err error
+		values, err = extractValues(kv.Value, valueFormat, valuePath)
+		if err != nil {
+			return nil, fmt.Errorf("error extracting values from %s: %v", kv.Key, err)
+		}
+	}
+
+	var series []alertSeries
+	for i, value := range values {
+		number, err := numericValue(value, mappings)
+		if err != nil {
+			return nil, fmt.Errorf("error converting value of %s: %v", kv.Key, err)
+		}
+		labels := data.Labels{"key": kv.Key}
+		if len(values) > 1 {
+			labels["index"] = strconv.Itoa(i)
+		}
+		series = append(series, alertSeries{labels: labels, value: number})
+	}
+	return series, nil
+}
+
+// numericValue converts a value to a number. Values with a value mapping are mapped,
+// otherwise numbers are parsed and booleans are converted to 1 and 0.
+func numericValue(value interface{}, mappings map[string]float64) (float64, error) {
+	if mapped, ok := mappings[fmt.Sprint(value)]; ok {
+		return mapped, nil
+	}
+
+	switch value := value.(type) {
+	case float64:
+		return value, nil
+	case bool:
+		if value {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return 0, fmt.Errorf("value %q is not numeric and has no value mapping", value)
+		}
+		return number, nil
+	}
+	return 0, fmt.Errorf("value %v is not numeric and has no value mapping", value)
+}
+
+// parseValueMappings parses comma-separated value mappings like passing=0,warning=1,critical=2
+func parseValueMappings(s string) (map[string]float64, error) {
+	mappings := map[string]float64{}
+	for _, mapping := range strings.Split(s, ",") {
+		if strings.TrimSpace(mapping) == "" {
+			continue
+		}
+		idx := strings.LastIndex(mapping, "=")
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid value mapping %q, expected value=number", mapping)
+		}
+		number, err := strconv.ParseFloat(strings.TrimSpace(mapping[idx+1:]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value mapping %q: %v", mapping, err)
+		}
+		mappings[strings.TrimSpace(mapping[:idx])] = number
+	}
+	return mappings, nil
+}
+
+// wideSeriesFrame returns a frame with a time field and a labeled number field per series
+func wideSeriesFrame(name string, series []alertSeries) *data.Frame {
+	frame := data.NewFrame(name, data.NewField("time", nil, []time.Time{time.Now()}))
+	for _, s := range series {
+		frame.Fields = append(frame.Fields, data.NewField("value", s.labels, []float64{s.value}))
+	}
+	frame.Meta = &data.FrameMeta{Type: data.FrameTypeTimeSeriesWide}
+	return frame
+}
+
+// longSeriesFrame returns a frame with a row per series. The labels of the series are string fields.
+func longSeriesFrame(name string, series []alertSeries) *data.Frame {
+	labelNames := map[string]bool{}
+	for _, s := range series {
+		for labelName := range s.labels {
+			labelNames[labelName] = true
+		}
+	}
+	var sortedLabelNames []string
+	for labelName := range labelNames {
+		sortedLabelNames = append(sortedLabelNames, labelName)
+	}
+	sort.Strings(sortedLabelNames)
+
+	now := time.Now()
+	times := make([]time.Time, len(series))
+	values := make([]float64, len(series))
+	labelValues := make([][]string, len(sortedLabelNames))
+	for i := range labelValues {
+		labelValues[i] = make([]string, len(series))
+	}
+	for i, s := range series {
+		times[i] = now
+		values[i] = s.value
+		for j, labelName := range sortedLabelNames {
+			labelValues[j][i] = s.labels[labelName]
+		}
+	}
+
+	frame := data.NewFrame(name, data.NewField("time", nil, times))
+	for j, labelName := range sortedLabelNames {
+		frame.Fields = append(frame.Fields, data.NewField(labelName, nil, labelValues[j]))
+	}
+	frame.Fields = append(frame.Fields, data.NewField("value", nil, values))
+	frame.Meta = &data.FrameMeta{Type: data.FrameTypeTimeSeriesLong}
+	return frame
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestParseValueMappings(t *testing.T) {
+	mappings, err := parseValueMappings("passing=0, warning = 1,critical=2,a=b=3,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]float64{"passing": 0, "warning": 1, "critical": 2, "a=b": 3}
+	if !reflect.DeepEqual(mappings, expected) {
+		t.Errorf("expected %v, got %v", expected, mappings)
+	}
+
+	for _, invalid := range []string{"passing", "passing=zero"} {
+		if _, err := parseValueMappings(invalid); err == nil {
+			t.Errorf("parseValueMappings(%q): expected error", invalid)
+		}
+	}
+}
+
+func TestNumericValue(t *testing.T) {
+	mappings := map[string]float64{"critical": 2, "false": -1}
+
+	var tests = []struct {
+		value    interface{}
+		expected float64
+		wantErr  bool
+	}{
+		{value: 3.5, expected: 3.5},
+		{value: " 42\n", expected: 42},
+		{value: true, expected: 1},
+		{value: false, expected: -1},
+		{value: "critical", expected: 2},
+		{value: "unknown", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		actual, err := numericValue(tt.value, mappings)
+		if (err != nil) != tt.wantErr || actual != tt.expected {
+			t.Errorf("numericValue(%v): expected %v (error %v), got %v (error %v)", tt.value, tt.expected, tt.wantErr, actual, err)
+		}
+	}
+}
+
+func TestQueryAlerting(t *testing.T) {
+	srv, consul := setupTestServer(t)
+	defer srv.Stop()
+
+	instance, err := newInstanceSettings(consul, jsonData{})
+	if err != nil {
+		t.Fatalf("could not create instance: %v", err)
+	}
+
+	spec := "registry/apiregistration.k8s.io/apiservices/v1.apps/spec/"
+	response := query(context.TODO(), instance, map[string]queryModel{
+		"get":      {Format: "timeseries", Type: "get", Target: "deployments/web/name", Alerting: true, ValueMappings: "web=1"},
+		"path":     {Format: "timeseries", Type: "get", Target: "deployments/web/config", Path: "ports", Alerting: true},
+		"keys":     {Format: "timeseries", Type: "keys", Target: "deployments", Alerting: true},
+		"tags":     {Format: "timeseries", Type: "tags", Target: spec, Alerting: true, ValueMappings: "apps=1,v1=1", SeriesFormat: "long"},
+		"unmapped": {Format: "timeseries", Type: "get", Target: "deployments/web/name", Alerting: true},
+		"missing":  {Format: "timeseries", Type: "get", Target: "deployments/missing", Alerting: true},
+	})
+
+	for refID, expected := range map[string]data.FrameType{"get": data.FrameTypeTimeSeriesWide, "path": data.FrameTypeTimeSeriesWide, "keys": data.FrameTypeTimeSeriesWide, "tags": data.FrameTypeTimeSeriesLong, "missing": data.FrameTypeTimeSeriesWide} {
+		res := response.Responses[refID]
+		if res.Error != nil || len(res.Frames) != 1 {
+			t.Fatalf("%s: expected one frame, got %d frames and error %v", refID, len(res.Frames), res.Error)
+		}
+		if res.Frames[0].Meta == nil || res.Frames[0].Meta.Type != expected {
+			t.Errorf("%s: expected frame type %s, got %+v", refID, expected, res.Frames[0].Meta)
+		}
+	}
+
+	get := response.Responses["get"].Frames[0]
+	if len(get.Fields) != 2 || get.Fields[1].At(0) != 1.0 || get.Fields[1].Labels["key"] != "deployments/web/name" {
+		t.Errorf("get: expected value 1 labeled with the key, got %v", get.Fields)
+	}
+
+	path := response.Responses["path"].Frames[0]
+	if len(path.Fields) != 3 || path.Fields[1].At(0) != 80.0 || path.Fields[2].At(0) != 443.0 || path.Fields[2].Labels["index"] != "1" {
+		t.Errorf("path: expected a series per port labeled with the index, got %v", path.Fields)
+	}
+
+	if keys := response.Responses["keys"].Frames[0]; len(keys.Fields) != 3 || keys.Fields[2].Labels["key"] != "deployments/web/" {
+		t.Errorf("keys: expected a series per subkey, got %v", keys.Fields)
+	}
+
+	tags := response.Responses["tags"].Frames[0]
+	if rows := tags.Rows(); rows != 4 || tags.Fields[1].Name != "key" || tags.Fields[1].At(0) != spec+"group" || tags.Fields[2].At(0) != 1.0 {
+		t.Errorf("tags: expected a row per subkey, got %d rows and fields %v", rows, tags.Fields)
+	}
+
+	if res := response.Responses["unmapped"]; res.Error == nil {
+		t.Errorf("unmapped: expected error for a string value without value mapping")
+	}
+
+	if missing := response.Responses["missing"].Frames[0]; len(missing.Fields) != 1 {
+		t.Errorf("missing: expected no series, got %v", missing.Fields)
+	}
+}
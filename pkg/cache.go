@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/hashicorp/consul/api"
+)
+
+// cacheRetention is how long expired responses are kept to be revalidated with the Consul index
+const cacheRetention = 10 * time.Minute
+
+// responseCache caches the responses of queries. Responses are returned without a request to Consul
+// until the ttl expired. Afterwards they are reused if the X-Consul-Index of the queried keys didn't change.
+type responseCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	response backend.DataResponse
+	// index is the X-Consul-Index of the keys before the query was executed, 0 if it is unknown
+	index   uint64
+	expires time.Time
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{
+		ttl:     ttl,
+		entries: map[string]*cacheEntry{},
+	}
+}
+
+// cachedQuery returns the cached response of query or executes it with run and caches the response.
+func (c *responseCache) cachedQuery(ctx context.Context, consul *api.Client, query queryModel, opts *api.QueryOptions, run func() backend.DataResponse) backend.DataResponse {
+	key, err := json.Marshal(query)
+	if err != nil {
+		return run()
+	}
+
+	entry, ok := c.get(string(key))
+	if ok && time.Now().Before(entry.expires) {
+		log.DefaultLogger.Debug("cachedQuery: cache hit", "query", query)
+		return copyResponse(entry.response)
+	}
+
+	index, err := kvIndex(ctx, consul, query, opts)
+	if err != nil {
+		log.DefaultLogger.Debug("cachedQuery: could not get index", "query", query, "err", err)
+	}
+	if ok && index != 0 && index == entry.index {
+		log.DefaultLogger.Debug("cachedQuery: revalidated", "query", query, "index", index)
+		c.set(string(key), entry.response, index)
+		return copyResponse(entry.response)
+	}
+
+	response := run()
+	if response.Error == nil {
+		c.set(string(key), response, index)
+	}
+	return copyResponse(response)
+}
+
+func (c *responseCache) get(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	return entry, ok
+}
+
+func (c *responseCache) set(key string, response backend.DataResponse, index uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expires.Add(cacheRetention)) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = &cacheEntry{
+		response: response,
+		index:    index,
+		expires:  now.Add(c.ttl),
+	}
+}
+
+func (c *responseCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[string]*cacheEntry{}
+}
+
+// kvIndex returns the X-Consul-Index of the keys read by a KV query. The keys are listed
+// without values, which is cheaper than executing the query. For other queries 0 is returned.
+func kvIndex(ctx context.Context, consul *api.Client, query queryModel, opts *api.QueryOptions) (uint64, error) {
+	prefix, ok := kvQueryPrefix(query)
+	if !ok {
+		return 0, nil
+	}
+	_, meta, err := consul.KV().Keys(prefix, "", opts.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	return meta.LastIndex, nil
+}
+
+// kvQueryPrefix returns the prefix of all keys read by a KV query. Only get, keys, tags, tagsrec and table
+// queries and variables of keys or values read keys, other queries and queries reading the whole key value
+// store are not revalidated with the index of their keys.
+func kvQueryPrefix(query queryModel) (string, bool) {
+	switch query.Type {
+	case "", "get", "keys", "tags", "tagsrec":
+	case "variable":
+		if query.VariableSource != "" && query.VariableSource != "keys" && query.VariableSource != "values" {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+
+	target := strings.Replace(query.Target, "\\.", ".", -1)
+	prefix := strings.TrimSuffix(target, "/")
+	if query.Format == "table" {
+		// table columns are relative to the matching keys and may be outside of the target prefix
+		prefixes := []string{wildcardPrefix(target)}
+		for _, col := range parseColumns(query.Columns) {
+			if strings.Count(col.key, "../") > strings.Count(target, "/") {
+				return "", false
+			}
+			prefixes = append(prefixes, wildcardPrefix(calculateColumnKey(target, col.key)))
+		}
+		prefix = commonPrefix(prefixes)
+	}
+	if prefix == "" {
+		return "", false
+	}
+	return prefix, true
+}
+
+func wildcardPrefix(key string) string {
+	if firstStar := strings.Index(key, "*"); firstStar >= 0 {
+		return key[:firstStar]
+	}
+	return key
+}
+
+// copyResponse returns a copy of the response which can be modified without changing the cached frames.
+// The time fields of time series are set to the current time.
+func copyResponse(response backend.DataResponse) backend.DataResponse {
+	if response.Frames == nil {
+		return response
+	}
+
+	now := time.Now()
+	frames := make([]*data.Frame, len(response.Frames))
+	for i, frame := range response.Frames {
+		copied := *frame
+		if frame.Meta != nil {
+			meta := *frame.Meta
+			copied.Meta = &meta
+		}
+		copied.Fields = make([]*data.Field, len(frame.Fields))
+		for j, field := range frame.Fields {
+			if field.Name == "time" && field.Type() == data.FieldTypeTime {
+				times := make([]time.Time, field.Len())
+				for k := range times {
+					times[k] = now
+				}
+				field = data.NewField(field.Name, field.Labels, times)
+			}
+			copied.Fields[j] = field
+		}
+		frames[i] = &copied
+	}
+	return backend.DataResponse{Frames: frames, Error: response.Error}
+}
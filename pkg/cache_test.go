@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/hashicorp/consul/api"
+)
+
+func TestKVQueryPrefix(t *testing.T) {
+	tests := []struct {
+		query    queryModel
+		expected string
+		ok       bool
+	}{
+		{query: queryModel{Type: "get", Target: "deployments/web/config"}, expected: "deployments/web/config", ok: true},
+		{query: queryModel{Type: "keys", Target: "deployments/"}, expected: "deployments", ok: true},
+		{query: queryModel{Format: "table", Target: "deployments/*/name", Columns: "../name,../config"}, expected: "deployments/", ok: true},
+		{query: queryModel{Format: "table", Target: "deployments/*/name", Columns: "../../other/name"}, expected: "deployments/", ok: true},
+		{query: queryModel{Format: "table", Target: "deployments/*/name", Columns: "../../../name"}, ok: false},
+		{query: queryModel{Format: "table", Target: "*/name", Columns: "../config"}, ok: false},
+		{query: queryModel{Type: "services"}, ok: false},
+		{query: queryModel{Type: "health"}, ok: false},
+		{query: queryModel{Type: "sessions", LockPrefix: "locks/"}, ok: false},
+		{query: queryModel{Type: "members", Pool: "wan"}, ok: false},
+		{query: queryModel{Type: "autopilot"}, ok: false},
+		{query: queryModel{Type: "topology", Format: "nodegraph"}, ok: false},
+		{query: queryModel{Type: "configentries", Kind: "service-splitter"}, ok: false},
+		{query: queryModel{Type: "preparedquery", Target: "web"}, ok: false},
+		{query: queryModel{Type: "acltokens", Target: "global-management"}, ok: false},
+		{query: queryModel{Type: "session", Target: "b2d8c1a4-5d6f-4e1b-9a3e-2f7c8d9e0a1b"}, ok: false},
+		{query: queryModel{Type: "unknown", Target: "deployments/"}, ok: false},
+		{query: queryModel{Type: "variable", VariableSource: "values", Target: "deployments/"}, expected: "deployments", ok: true},
+		{query: queryModel{Type: "variable", VariableSource: "tags"}, ok: false},
+	}
+	for _, tt := range tests {
+		prefix, ok := kvQueryPrefix(tt.query)
+		if prefix != tt.expected || ok != tt.ok {
+			t.Errorf("kvQueryPrefix(%+v): expected %q %v, got %q %v", tt.query, tt.expected, tt.ok, prefix, ok)
+		}
+	}
+}
+
+func TestCopyResponse(t *testing.T) {
+	then := time.Now().Add(-time.Hour)
+	response := backend.DataResponse{Frames: []*data.Frame{
+		data.NewFrame("key",
+			data.NewField("time", nil, []time.Time{then}),
+			data.NewField("values", nil, []float64{1}),
+		),
+	}}
+
+	copied := copyResponse(response)
+	copied.Frames[0].SetMeta(&data.FrameMeta{Channel: "ds/uid/get/key"})
+
+	if response.Frames[0].Meta != nil {
+		t.Errorf("expected meta of cached frame to be unchanged")
+	}
+	if ts := copied.Frames[0].Fields[0].At(0).(time.Time); !ts.After(then) {
+		t.Errorf("expected time to be refreshed, got %v", ts)
+	}
+	if value := copied.Frames[0].Fields[1].At(0); value != float64(1) {
+		t.Errorf("expected value 1, got %v", value)
+	}
+}
+
+func TestQueryCached(t *testing.T) {
+	srv, consul := setupTestServer(t)
+	defer srv.Stop()
+
+	key := "deployments/web/replicas"
+	put := func(value string) {
+		if _, err := consul.KV().Put(&api.KVPair{Key: key, Value: []byte(value)}, nil); err != nil {
+			t.Fatalf("could not put %s: %v", key, err)
+		}
+	}
+	queries := map[string]queryModel{"A": {Format: "timeseries", Type: "get", Target: key}}
+	value := func(instance *instanceSettings) interface{} {
+		response := query(context.TODO(), instance, queries).Responses["A"]
+		if response.Error != nil {
+			t.Fatalf("unexpected error: %v", response.Error)
+		}
+		return response.Frames[0].Fields[1].At(0)
+	}
+
+	put("1")
+
+	t.Run("ttl", func(t *testing.T) {
+		instance, err := newInstanceSettings(consul, jsonData{CacheTTL: "1h", Consistency: "stale"})
+		if err != nil {
+			t.Fatalf("could not create instance: %v", err)
+		}
+		defer put("1")
+
+		if v := value(instance); v != float64(1) {
+			t.Fatalf("expected 1, got %v", v)
+		}
+		put("2")
+		if v := value(instance); v != float64(1) {
+			t.Errorf("expected cached value 1, got %v", v)
+		}
+
+		instance.Dispose()
+		if v := value(instance); v != float64(2) {
+			t.Errorf("expected 2 after cache was cleared, got %v", v)
+		}
+	})
+
+	t.Run("revalidate", func(t *testing.T) {
+		instance, err := newInstanceSettings(consul, jsonData{CacheTTL: "1ns"})
+		if err != nil {
+			t.Fatalf("could not create instance: %v", err)
+		}
+		defer put("1")
+
+		if v := value(instance); v != float64(1) {
+			t.Fatalf("expected 1, got %v", v)
+		}
+		if v := value(instance); v != float64(1) {
+			t.Errorf("expected revalidated value 1, got %v", v)
+		}
+		put("2")
+		if v := value(instance); v != float64(2) {
+			t.Errorf("expected 2 after the index changed, got %v", v)
+		}
+	})
+}
+
+func TestNewInstanceSettingsInvalidCache(t *testing.T) {
+	if _, err := newInstanceSettings(nil, jsonData{CacheTTL: "1 minute"}); err == nil {
+		t.Errorf("expected error for invalid cache ttl")
+	}
+	if _, err := newInstanceSettings(nil, jsonData{Consistency: "eventual"}); err == nil {
+		t.Errorf("expected error for unknown consistency mode")
+	}
+}
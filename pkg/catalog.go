@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/hashicorp/consul/api"
+)
+
+func queryCatalog(ctx context.Context, consul *api.Client, query queryModel, opts *api.QueryOptions) backend.DataResponse {
+	log.DefaultLogger.Debug("queryCatalog", "query", query)
+
+	opts, err := catalogQueryOptions(ctx, query, opts)
+	if err != nil {
+		return backend.DataResponse{Error: err}
+	}
+
+	switch query.Type {
+	case "services":
+		return handleServices(consul, splitList(query.Tag), opts)
+	case "nodes":
+		return handleNodes(consul, opts)
+	case "service":
+		return handleServiceInstances(consul, query.Target, splitList(query.Tag), opts)
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown query type: %s", query.Type)}
+}
+
+// catalogQueryOptions returns a copy of opts for the catalog and health APIs
+// with the node meta filters of the query.
+func catalogQueryOptions(ctx context.Context, query queryModel, opts *api.QueryOptions) (*api.QueryOptions, error) {
+	nodeMeta, err := parseNodeMeta(query.NodeMeta)
+	if err != nil {
+		return nil, err
+	}
+	catalogOpts := opts.WithContext(ctx)
+	catalogOpts.NodeMeta = nodeMeta
+	return catalogOpts, nil
+}
+
+func handleServices(consul *api.Client, tags []string, opts *api.QueryOptions) backend.DataResponse {
+	log.DefaultLogger.Debug("handleServices", "tags", tags)
+
+	services, _, err := consul.Catalog().Services(opts)
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error consul catalog services: %v", err)}
+	}
+
+	var names []string
+	for name, serviceTags := range services {
+		if containsAll(serviceTags, tags) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	frame := data.NewFrame("services",
+		data.NewField("service", nil, []string{}),
+		data.NewField("tags", nil, []string{}),
+	)
+	for _, name := range names {
+		frame.AppendRow(name, joinSorted(services[name]))
+	}
+	return backend.DataResponse{Frames: []*data.Frame{frame}}
+}
+
+func handleNodes(consul *api.Client, opts *api.QueryOptions) backend.DataResponse {
+	log.DefaultLogger.Debug("handleNodes", "nodeMeta", opts.NodeMeta)
+
+	nodes, _, err := consul.Catalog().Nodes(opts)
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error consul catalog nodes: %v", err)}
+	}
+
+	frame := data.NewFrame("nodes",
+		data.NewField("node", nil, []string{}),
+		data.NewField("id", nil, []string{}),
+		data.NewField("address", nil, []string{}),
+		data.NewField("datacenter", nil, []string{}),
+		data.NewField("meta", nil, []string{}),
+	)
+	for _, node := range nodes {
+		frame.AppendRow(node.Node, node.ID, node.Address, node.Datacenter, joinMap(node.Meta))
+	}
+	return backend.DataResponse{Frames: []*data.Frame{frame}}
+}
+
+func handleServiceInstances(consul *api.Client, service string, tags []string, opts *api.QueryOptions) backend.DataResponse {
+	log.DefaultLogger.Debug("handleServiceInstances", "service", service, "tags", tags)
+
+	if service == "" {
+		return backend.DataResponse{Error: fmt.Errorf("service name should not be empty")}
+	}
+
+	instances, _, err := consul.Catalog().ServiceMultipleTags(service, tags, opts)
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error consul catalog service %s: %v", service, err)}
+	}
+
+	frame := data.NewFrame(service,
+		data.NewField("node", nil, []string{}),
+		data.NewField("address", nil, []string{}),
+		data.NewField("datacenter", nil, []string{}),
+		data.NewField("serviceID", nil, []string{}),
+		data.NewField("serviceAddress", nil, []string{}),
+		data.NewField("servicePort", nil, []int64{}),
+		data.NewField("serviceTags", nil, []string{}),
+		data.NewField("serviceMeta", nil, []string{}),
+	)
+	for _, instance := range instances {
+		frame.AppendRow(instance.Node, instance.Address, instance.Datacenter, instance.ServiceID,
+			instance.ServiceAddress, int64(instance.ServicePort), joinSorted(instance.ServiceTags), joinMap(instance.ServiceMeta))
+	}
+	return backend.DataResponse{Frames: []*data.Frame{frame}}
+}
+
+// parseNodeMeta parses node meta filters in the format key1=value1,key2=value2
+func parseNodeMeta(nodeMeta string) (map[string]string, error) {
+	filters := splitList(nodeMeta)
+	if len(filters) == 0 {
+		return nil, nil
+	}
+
+	meta := map[string]string{}
+	for _, filter := range filters {
+		parts := strings.SplitN(filter, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid node meta filter %s, expected key=value", filter)
+		}
+		meta[parts[0]] = parts[1]
+	}
+	return meta, nil
+}
+
+// splitList splits a comma-separated list and drops empty elements
+func splitList(list string) []string {
+	var elements []string
+	for _, element := range strings.Split(list, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+func containsAll(list []string, elements []string) bool {
+	for _, element := range elements {
+		found := false
+		for _, e := range list {
+			if e == element {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func joinSorted(list []string) string {
+	sorted := append([]string{}, list...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+func joinMap(m map[string]string) string {
+	var pairs []string
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	return joinSorted(pairs)
+}
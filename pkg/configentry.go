@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/hashicorp/consul/api"
+)
+
+// configEntryTable flattens the config entries of a kind into a table.
+// columns are the columns after name and namespace, rows returns the rows of an entry without them.
+type configEntryTable struct {
+	columns []*data.Field
+	rows    func(entry api.ConfigEntry) [][]interface{}
+}
+
+// configEntryKinds are the supported kinds of config entries, all of them are queried if the query has no kind
+var configEntryKinds = []string{
+	api.ServiceDefaults,
+	api.ProxyDefaults,
+	api.ServiceRouter,
+	api.ServiceSplitter,
+	api.ServiceResolver,
+	api.IngressGateway,
+	api.TerminatingGateway,
+}
+
+// queryConfigEntries returns the config entries of the kind of the query, or of all supported kinds.
+// If the target is set, only the config entry with the target name is returned.
+// Tables contain a frame per kind. Time series contain the weights of the splits of service splitters
+// and the number of entries of the other kinds.
+func queryConfigEntries(ctx context.Context, consul *api.Client, query queryModel, opts *api.QueryOptions) backend.DataResponse {
+	log.DefaultLogger.Debug("queryConfigEntries", "query", query)
+
+	kinds := configEntryKinds
+	if query.Kind != "" {
+		if configEntryTables(query.Kind) == nil {
+			return backend.DataResponse{Error: fmt.Errorf("unsupported config entry kind %s", query.Kind)}
+		}
+		kinds = []string{query.Kind}
+	}
+
+	opts = opts.WithContext(ctx)
+	entries := map[string][]api.ConfigEntry{}
+	for _, kind := range kinds {
+		kindEntries, err := getConfigEntries(consul, kind, query.Target, opts)
+		if err != nil {
+			return backend.DataResponse{Error: err}
+		}
+		entries[kind] = kindEntries
+	}
+
+	switch query.Format {
+	case "", "timeseries":
+		return generateDataResponseFromConfigEntries(kinds, entries)
+	case "table":
+		return generateTablesFromConfigEntries(kinds, entries)
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown format %s", query.Format)}
+}
+
+// getConfigEntries returns the config entries of a kind sorted by name, or the entry with the name if it is not empty
+func getConfigEntries(consul *api.Client, kind, name string, opts *api.QueryOptions) ([]api.ConfigEntry, error) {
+	if name != "" {
+		entry, _, err := consul.ConfigEntries().Get(kind, name, opts)
+		if err != nil {
+			if statusErr, ok := err.(api.StatusError); ok && statusErr.Code == http.StatusNotFound {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("error consul config entry %s %s: %v", kind, name, err)
+		}
+		return []api.ConfigEntry{entry}, nil
+	}
+
+	entries, _, err := consul.ConfigEntries().List(kind, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error consul config entries %s: %v", kind, err)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].GetNamespace() != entries[j].GetNamespace() {
+			return entries[i].GetNamespace() < entries[j].GetNamespace()
+		}
+		return entries[i].GetName() < entries[j].GetName()
+	})
+	return entries, nil
+}
+
+func generateDataResponseFromConfigEntries(kinds []string, entries map[string][]api.ConfigEntry) backend.DataResponse {
+	response := backend.DataResponse{}
+	now := time.Now()
+	series := func(name string, labels data.Labels, value float64) {
+		response.Frames = append(response.Frames, data.NewFrame(name,
+			data.NewField("time", nil, []time.Time{now}),
+			data.NewField("values", labels, []float64{value}),
+		))
+	}
+
+	for _, kind := range kinds {
+		if kind != api.ServiceSplitter {
+			series(kind, data.Labels{"kind": kind}, float64(len(entries[kind])))
+			continue
+		}
+		for _, entry := range entries[kind] {
+			splitter := entry.(*api.ServiceSplitterConfigEntry)
+			for _, split := range splitter.Splits {
+				labels := data.Labels{
+					"kind":      kind,
+					"name":      splitter.Name,
+					"service":   split.Service,
+					"subset":    split.ServiceSubset,
+					"namespace": split.Namespace,
+				}
+				series(splitter.Name+" "+split.Service+" "+split.ServiceSubset, labels, float64(split.Weight))
+			}
+		}
+	}
+	return response
+}
+
+func generateTablesFromConfigEntries(kinds []string, entries map[string][]api.ConfigEntry) backend.DataResponse {
+	response := backend.DataResponse{}
+	for _, kind := range kinds {
+		table := configEntryTables(kind)
+		frame := data.NewFrame(kind, append([]*data.Field{
+			data.NewField("name", nil, []string{}),
+			data.NewField("namespace", nil, []string{}),
+		}, table.columns...)...)
+		for _, entry := range entries[kind] {
+			for _, row := range table.rows(entry) {
+				frame.AppendRow(append([]interface{}{entry.GetName(), entry.GetNamespace()}, row...)...)
+			}
+		}
+		response.Frames = append(response.Frames, frame)
+	}
+	return response
+}
+
+// configEntryTables returns the table of a kind of config entries, or nil if the kind is not supported.
+// Entries with lists, e.g. the routes of a service router, have a row per element of the list and
+// a row with empty values if the list is empty.
+func configEntryTables(kind string) *configEntryTable {
+	switch kind {
+	case api.ServiceDefaults:
+		return &configEntryTable{
+			columns: []*data.Field{
+				data.NewField("protocol", nil, []string{}),
+				data.NewField("mode", nil, []string{}),
+				data.NewField("meshGateway", nil, []string{}),
+				data.NewField("externalSNI", nil, []string{}),
+			},
+			rows: func(entry api.ConfigEntry) [][]interface{} {
+				e := entry.(*api.ServiceConfigEntry)
+				return [][]interface{}{{e.Protocol, string(e.Mode), string(e.MeshGateway.Mode), e.ExternalSNI}}
+			},
+		}
+	case api.ProxyDefaults:
+		return &configEntryTable{
+			columns: []*data.Field{
+				data.NewField("mode", nil, []string{}),
+				data.NewField("meshGateway", nil, []string{}),
+				data.NewField("config", nil, []string{}),
+			},
+			rows: func(entry api.ConfigEntry) [][]interface{} {
+				e := entry.(*api.ProxyConfigEntry)
+				config := ""
+				if len(e.Config) > 0 {
+					b, _ := json.Marshal(e.Config)
+					config = string(b)
+				}
+				return [][]interface{}{{string(e.Mode), string(e.MeshGateway.Mode), config}}
+			},
+		}
+	case api.ServiceRouter:
+		return &configEntryTable{
+			columns: []*data.Field{
+				data.NewField("pathExact", nil, []string{}),
+				data.NewField("pathPrefix", nil, []string{}),
+				data.NewField("pathRegex", nil, []string{}),
+				data.NewField("methods", nil, []string{}),
+				data.NewField("service", nil, []string{}),
+				data.NewField("serviceSubset", nil, []string{}),
+				data.NewField("serviceNamespace", nil, []string{}),
+				data.NewField("prefixRewrite", nil, []string{}),
+				data.NewField("requestTimeout", nil, []string{}),
+				data.NewField("numRetries", nil, []int64{}),
+			},
+			rows: func(entry api.ConfigEntry) [][]interface{} {
+				e := entry.(*api.ServiceRouterConfigEntry)
+				if len(e.Routes) == 0 {
+					return [][]interface{}{{"", "", "", "", "", "", "", "", "", int64(0)}}
+				}
+				var rows [][]interface{}
+				for _, route := range e.Routes {
+					match := api.ServiceRouteHTTPMatch{}
+					if route.Match != nil && route.Match.HTTP != nil {
+						match = *route.Match.HTTP
+					}
+					destination := api.ServiceRouteDestination{}
+					if route.Destination != nil {
+						destination = *route.Destination
+					}
+					requestTimeout := ""
+					if destination.RequestTimeout != 0 {
+						requestTimeout = destination.RequestTimeout.String()
+					}
+					rows = append(rows, []interface{}{match.PathExact, match.PathPrefix, match.PathRegex,
+						strings.Join(match.Methods, ","), destination.Service, destination.ServiceSubset,
+						destination.Namespace, destination.PrefixRewrite, requestTimeout, int64(destination.NumRetries)})
+				}
+				return rows
+			},
+		}
+	case api.ServiceSplitter:
+		return &configEntryTable{
+			columns: []*data.Field{
+				data.NewField("weight", nil, []float64{}),
+				data.NewField("service", nil, []string{}),
+				data.NewField("serviceSubset", nil, []string{}),
+				data.NewField("serviceNamespace", nil, []string{}),
+			},
+			rows: func(entry api.ConfigEntry) [][]interface{} {
+				e := entry.(*api.ServiceSplitterConfigEntry)
+				if len(e.Splits) == 0 {
+					return [][]interface{}{{float64(0), "", "", ""}}
+				}
+				var rows [][]interface{}
+				for _, split := range e.Splits {
+					rows = append(rows, []interface{}{float64(split.Weight), split.Service, split.ServiceSubset, split.Namespace})
+				}
+				return rows
+			},
+		}
+	case api.ServiceResolver:
+		return &configEntryTable{
+			columns: []*data.Field{
+				data.NewField("defaultSubset", nil, []string{}),
+				data.NewField("subsets", nil, []string{}),
+				data.NewField("redirect", nil, []string{}),
+				data.NewField("failover", nil, []string{}),
+				data.NewField("connectTimeout", nil, []string{}),
+			},
+			rows: func(entry api.ConfigEntry) [][]interface{} {
+				e := entry.(*api.ServiceResolverConfigEntry)
+				subsets := map[string]string{}
+				for name, subset := range e.Subsets {
+					subsets[name] = subset.Filter
+				}
+				redirect := ""
+				if e.Redirect != nil {
+					redirect = resolverTarget(e.Redirect.Service, e.Redirect.ServiceSubset, e.Redirect.Namespace, []string{e.Redirect.Datacenter})
+				}
+				failover := map[string]string{}
+				for subset, target := range e.Failover {
+					failover[subset] = resolverTarget(target.Service, target.ServiceSubset, target.Namespace, target.Datacenters)
+				}
+				connectTimeout := ""
+				if e.ConnectTimeout != 0 {
+					connectTimeout = e.ConnectTimeout.String()
+				}
+				return [][]interface{}{{e.DefaultSubset, joinMap(subsets), redirect, joinMap(failover), connectTimeout}}
+			},
+		}
+	case api.IngressGateway:
+		return &configEntryTable{
+			columns: []*data.Field{
+				data.NewField("port", nil, []int64{}),
+				data.NewField("protocol", nil, []string{}),
+				data.NewField("service", nil, []string{}),
+				data.NewField("hosts", nil, []string{}),
+			},
+			rows: func(entry api.ConfigEntry) [][]interface{} {
+				e := entry.(*api.IngressGatewayConfigEntry)
+				var rows [][]interface{}
+				for _, listener := range e.Listeners {
+					for _, service := range listener.Services {
+						rows = append(rows, []interface{}{int64(listener.Port), listener.Protocol,
+							intentionService(service.Namespace, service.Name), strings.Join(service.Hosts, ",")})
+					}
+				}
+				if len(rows) == 0 {
+					return [][]interface{}{{int64(0), "", "", ""}}
+				}
+				return rows
+			},
+		}
+	case api.TerminatingGateway:
+		return &configEntryTable{
+			columns: []*data.Field{
+				data.NewField("service", nil, []string{}),
+				data.NewField("caFile", nil, []string{}),
+				data.NewField("certFile", nil, []string{}),
+				data.NewField("keyFile", nil, []string{}),
+				data.NewField("sni", nil, []string{}),
+			},
+			rows: func(entry api.ConfigEntry) [][]interface{} {
+				e := entry.(*api.TerminatingGatewayConfigEntry)
+				if len(e.Services) == 0 {
+					return [][]interface{}{{"", "", "", "", ""}}
+				}
+				var rows [][]interface{}
+				for _, service := range e.Services {
+					rows = append(rows, []interface{}{intentionService(service.Namespace, service.Name),
+						service.CAFile, service.CertFile, service.KeyFile, service.SNI})
+				}
+				return rows
+			},
+		}
+	}
+	return nil
+}
+
+// resolverTarget returns the target of a redirect or failover of a service resolver, e.g. subset.service.namespace@dc1,dc2
+func resolverTarget(service, subset, namespace string, datacenters []string) string {
+	var parts []string
+	for _, part := range []string{subset, service, namespace} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	target := strings.Join(parts, ".")
+	var dcs []string
+	for _, dc := range datacenters {
+		if dc != "" {
+			dcs = append(dcs, dc)
+		}
+	}
+	if len(dcs) > 0 {
+		target += "@" + strings.Join(dcs, ",")
+	}
+	return target
+}
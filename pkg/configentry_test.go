@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func TestResolverTarget(t *testing.T) {
+	for _, tc := range []struct {
+		service, subset, namespace string
+		datacenters                []string
+		expected                   string
+	}{
+		{service: "web", expected: "web"},
+		{service: "web", subset: "v2", namespace: "team", expected: "v2.web.team"},
+		{datacenters: []string{"dc2", "dc3"}, expected: "@dc2,dc3"},
+		{service: "web", datacenters: []string{""}, expected: "web"},
+	} {
+		if actual := resolverTarget(tc.service, tc.subset, tc.namespace, tc.datacenters); actual != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, actual)
+		}
+	}
+}
+
+// setTestConfigEntries routes /admin of web to admin and splits the other requests between the subsets v1 and v2
+func setTestConfigEntries(t *testing.T, consul *api.Client) {
+	for _, entry := range []api.ConfigEntry{
+		&api.ServiceConfigEntry{Kind: api.ServiceDefaults, Name: "web", Protocol: "http"},
+		&api.ServiceConfigEntry{Kind: api.ServiceDefaults, Name: "admin", Protocol: "http"},
+		&api.ServiceResolverConfigEntry{
+			Kind: api.ServiceResolver, Name: "web", DefaultSubset: "v1", ConnectTimeout: 5 * time.Second,
+			Subsets: map[string]api.ServiceResolverSubset{
+				"v1": {Filter: "Service.Meta.version == v1"},
+				"v2": {Filter: "Service.Meta.version == v2"},
+			},
+		},
+		&api.ServiceSplitterConfigEntry{Kind: api.ServiceSplitter, Name: "web", Splits: []api.ServiceSplit{
+			{Weight: 90, ServiceSubset: "v1"},
+			{Weight: 10, ServiceSubset: "v2"},
+		}},
+		&api.ServiceRouterConfigEntry{Kind: api.ServiceRouter, Name: "web", Routes: []api.ServiceRoute{{
+			Match:       &api.ServiceRouteMatch{HTTP: &api.ServiceRouteHTTPMatch{PathPrefix: "/admin"}},
+			Destination: &api.ServiceRouteDestination{Service: "admin", NumRetries: 3},
+		}}},
+	} {
+		if _, _, err := consul.ConfigEntries().Set(entry, nil); err != nil {
+			t.Fatalf("could not set config entry %s %s: %v", entry.GetKind(), entry.GetName(), err)
+		}
+	}
+}
+
+func TestQueryConfigEntries(t *testing.T) {
+	_, _, instance := sharedTestServer(t)
+
+	response := query(context.TODO(), instance, map[string]queryModel{
+		"table":       {Format: "table", Type: "configentries"},
+		"timeseries":  {Format: "timeseries", Type: "configentries", Kind: api.ServiceSplitter},
+		"get":         {Format: "table", Type: "configentries", Kind: api.ServiceDefaults, Target: "admin"},
+		"missing":     {Format: "table", Type: "configentries", Kind: api.ServiceDefaults, Target: "missing"},
+		"unsupported": {Format: "table", Type: "configentries", Kind: api.ServiceIntentions},
+	})
+
+	t.Run("table", func(t *testing.T) {
+		res := response.Responses["table"]
+		if res.Error != nil || len(res.Frames) != len(configEntryKinds) {
+			t.Fatalf("expected a frame per kind, got %d frames and error %v", len(res.Frames), res.Error)
+		}
+		frames := map[string][]interface{}{}
+		for _, frame := range res.Frames {
+			if frame.Rows() > 0 {
+				frames[frame.Name] = frame.RowCopy(frame.Rows() - 1)
+			}
+		}
+		for kind, expected := range map[string][]interface{}{
+			api.ServiceDefaults: {"web", "", "http", "", "", ""},
+			api.ServiceResolver: {"web", "", "v1", "v1=Service.Meta.version == v1,v2=Service.Meta.version == v2", "", "", "5s"},
+			api.ServiceSplitter: {"web", "", 10.0, "", "v2", ""},
+			api.ServiceRouter:   {"web", "", "", "/admin", "", "", "admin", "", "", "", "", int64(3)},
+		} {
+			actual := frames[kind]
+			if len(actual) != len(expected) {
+				t.Errorf("%s: expected %v, got %v", kind, expected, actual)
+				continue
+			}
+			for i := range expected {
+				if actual[i] != expected[i] {
+					t.Errorf("%s: expected %v, got %v", kind, expected, actual)
+					break
+				}
+			}
+		}
+	})
+
+	t.Run("timeseries", func(t *testing.T) {
+		res := response.Responses["timeseries"]
+		if res.Error != nil || len(res.Frames) != 2 {
+			t.Fatalf("expected a series per split, got %d frames and error %v", len(res.Frames), res.Error)
+		}
+		for _, frame := range res.Frames {
+			values := frame.Fields[1]
+			expected := map[string]float64{"v1": 90, "v2": 10}[values.Labels["subset"]]
+			if values.At(0) != expected || values.Labels["name"] != "web" {
+				t.Errorf("expected weight %v, got %v with labels %v", expected, values.At(0), values.Labels)
+			}
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		res := response.Responses["get"]
+		if res.Error != nil || len(res.Frames) != 1 || res.Frames[0].Rows() != 1 || res.Frames[0].Fields[0].At(0) != "admin" {
+			t.Errorf("expected the admin service defaults, got error %v", res.Error)
+		}
+		res = response.Responses["missing"]
+		if res.Error != nil || len(res.Frames) != 1 || res.Frames[0].Rows() != 0 {
+			t.Errorf("expected an empty table for a missing entry, got error %v", res.Error)
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		if res := response.Responses["unsupported"]; res.Error == nil {
+			t.Errorf("expected error for unsupported kind")
+		}
+	})
+}
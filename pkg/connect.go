@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/hashicorp/consul/api"
+)
+
+// queryIntentions returns the Connect intentions, filtered by the target service as source or destination.
+// Time series contain the number of intentions per action, node graphs the services as nodes and the
+// intentions as edges.
+func queryIntentions(ctx context.Context, consul *api.Client, query queryModel, opts *api.QueryOptions) backend.DataResponse {
+	log.DefaultLogger.Debug("queryIntentions", "query", query)
+
+	intentions, _, err := consul.Connect().Intentions(opts.WithContext(ctx))
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error consul intentions: %v", err)}
+	}
+	if query.Target != "" {
+		var filtered []*api.Intention
+		for _, intention := range intentions {
+			if intention.SourceName == query.Target || intention.DestinationName == query.Target {
+				filtered = append(filtered, intention)
+			}
+		}
+		intentions = filtered
+	}
+
+	switch query.Format {
+	case "", "timeseries":
+		return generateDataResponseFromIntentions(intentions)
+	case "table":
+		return generateTableFromIntentions(intentions)
+	case "nodegraph":
+		return generateNodeGraphFromIntentions(intentions)
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown format %s", query.Format)}
+}
+
+// intentionAction returns the action of an intention, intentions with L7 permissions have the action l7
+func intentionAction(intention *api.Intention) string {
+	if intention.Action == "" && len(intention.Permissions) > 0 {
+		return "l7"
+	}
+	return string(intention.Action)
+}
+
+// generateDataResponseFromIntentions returns a series per action with the number of intentions
+func generateDataResponseFromIntentions(intentions []*api.Intention) backend.DataResponse {
+	counts := map[string]float64{string(api.IntentionActionAllow): 0, string(api.IntentionActionDeny): 0}
+	for _, intention := range intentions {
+		counts[intentionAction(intention)]++
+	}
+	var actions []string
+	for action := range counts {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+
+	response := backend.DataResponse{}
+	now := time.Now()
+	for _, action := range actions {
+		response.Frames = append(response.Frames, data.NewFrame(action,
+			data.NewField("time", nil, []time.Time{now}),
+			data.NewField("values", data.Labels{"action": action}, []float64{counts[action]}),
+		))
+	}
+	return response
+}
+
+func generateTableFromIntentions(intentions []*api.Intention) backend.DataResponse {
+	frame := data.NewFrame("intentions",
+		data.NewField("id", nil, []string{}),
+		data.NewField("source", nil, []string{}),
+		data.NewField("destination", nil, []string{}),
+		data.NewField("action", nil, []string{}),
+		data.NewField("permissions", nil, []int64{}),
+		data.NewField("precedence", nil, []int64{}),
+		data.NewField("sourceType", nil, []string{}),
+		data.NewField("description", nil, []string{}),
+	)
+	for _, intention := range intentions {
+		frame.AppendRow(intention.ID, intentionService(intention.SourceNS, intention.SourceName),
+			intentionService(intention.DestinationNS, intention.DestinationName), intentionAction(intention),
+			int64(len(intention.Permissions)), int64(intention.Precedence), string(intention.SourceType), intention.Description)
+	}
+	return backend.DataResponse{Frames: []*data.Frame{frame}}
+}
+
+// generateNodeGraphFromIntentions returns the services as nodes and an edge per intention from source to destination
+func generateNodeGraphFromIntentions(intentions []*api.Intention) backend.DataResponse {
+	graph := newNodeGraph()
+	for _, intention := range intentions {
+		source := intentionService(intention.SourceNS, intention.SourceName)
+		destination := intentionService(intention.DestinationNS, intention.DestinationName)
+		graph.addNode(source, 0)
+		graph.addNode(destination, 0)
+		graph.addEdge(source, destination, intentionAction(intention))
+	}
+	return graph.response()
+}
+
+// intentionService returns the name of a service of an intention, prefixed with its namespace if it is not the default namespace
+func intentionService(namespace, name string) string {
+	if namespace == "" || namespace == "default" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// queryTopology returns the upstreams of the services in the catalog, derived from the registered Connect proxies.
+// The edges from a service to its upstreams are labeled with the action of the matching intention, or default if
+// no intention matches. Time series contain the number of upstreams per service.
+// The instances of the services are fetched with up to concurrency parallel requests.
+func queryTopology(ctx context.Context, consul *api.Client, query queryModel, concurrency int, opts *api.QueryOptions) backend.DataResponse {
+	log.DefaultLogger.Debug("queryTopology", "query", query)
+
+	opts = opts.WithContext(ctx)
+	topology, err := getTopology(ctx, consul, concurrency, opts)
+	if err != nil {
+		return backend.DataResponse{Error: err}
+	}
+	intentions, _, err := consul.Connect().Intentions(opts)
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error consul intentions: %v", err)}
+	}
+
+	switch query.Format {
+	case "", "timeseries":
+		return generateDataResponseFromTopology(topology)
+	case "table":
+		return generateTableFromTopology(topology, intentions)
+	case "nodegraph":
+		return generateNodeGraphFromTopology(topology, intentions)
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown format %s", query.Format)}
+}
+
+// serviceTopology is a service with the number of its instances and its upstreams
+type serviceTopology struct {
+	name      string
+	instances int
+	upstreams []string
+}
+
+// getTopology returns the services of the catalog with their upstreams, sorted by name.
+// Proxies are not returned as services, their upstreams are added to their destination service.
+func getTopology(ctx context.Context, consul *api.Client, concurrency int, opts *api.QueryOptions) ([]*serviceTopology, error) {
+	services, _, err := consul.Catalog().Services(opts)
+	if err != nil {
+		return nil, fmt.Errorf("error consul catalog services: %v", err)
+	}
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	catalog, err := fetchCatalogServices(ctx, consul, names, concurrency, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	topology := map[string]*serviceTopology{}
+	service := func(name string) *serviceTopology {
+		if _, ok := topology[name]; !ok {
+			topology[name] = &serviceTopology{name: name}
+		}
+		return topology[name]
+	}
+	for name, instances := range catalog {
+		for _, instance := range instances {
+			// the catalog does not return the kind of a service, proxies have a destination service
+			if instance.ServiceProxy == nil || instance.ServiceProxy.DestinationServiceName == "" {
+				service(name).instances++
+				continue
+			}
+			destination := service(instance.ServiceProxy.DestinationServiceName)
+			for _, upstream := range instance.ServiceProxy.Upstreams {
+				if upstream.DestinationType == api.UpstreamDestTypePreparedQuery {
+					continue
+				}
+				if !containsAll(destination.upstreams, []string{upstream.DestinationName}) {
+					destination.upstreams = append(destination.upstreams, upstream.DestinationName)
+				}
+			}
+		}
+	}
+	// upstreams without instances in the catalog are added as services, too
+	var upstreams []string
+	for _, s := range topology {
+		upstreams = append(upstreams, s.upstreams...)
+	}
+	for _, upstream := range upstreams {
+		service(upstream)
+	}
+
+	var result []*serviceTopology
+	for _, s := range topology {
+		sort.Strings(s.upstreams)
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].name < result[j].name
+	})
+	return result, nil
+}
+
+// fetchCatalogServices fetches the instances of the services with a pool of concurrency workers.
+// The first error cancels the remaining requests.
+func fetchCatalogServices(ctx context.Context, consul *api.Client, names []string, concurrency int, opts *api.QueryOptions) (map[string][]*api.CatalogService, error) {
+	values, err := fetchConcurrently(ctx, names, concurrency, func(ctx context.Context, name string) (interface{}, error) {
+		instances, _, err := consul.Catalog().Service(name, "", opts.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("error consul catalog service %s: %v", name, err)
+		}
+		return instances, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string][]*api.CatalogService{}
+	for name, value := range values {
+		result[name] = value.([]*api.CatalogService)
+	}
+	return result, nil
+}
+
+// intentionDecision returns the action of the intention with the highest precedence matching source and destination.
+// The intentions are sorted by precedence by Consul.
+func intentionDecision(intentions []*api.Intention, source, destination string) string {
+	for _, intention := range intentions {
+		if (intention.SourceName == source || intention.SourceName == "*") &&
+			(intention.DestinationName == destination || intention.DestinationName == "*") {
+			return intentionAction(intention)
+		}
+	}
+	return "default"
+}
+
+func generateDataResponseFromTopology(topology []*serviceTopology) backend.DataResponse {
+	response := backend.DataResponse{}
+	now := time.Now()
+	for _, service := range topology {
+		response.Frames = append(response.Frames, data.NewFrame(service.name,
+			data.NewField("time", nil, []time.Time{now}),
+			data.NewField("values", data.Labels{"service": service.name}, []float64{float64(len(service.upstreams))}),
+		))
+	}
+	return response
+}
+
+// generateTableFromTopology returns a row per service and upstream. Services without upstreams have a row with an empty upstream.
+func generateTableFromTopology(topology []*serviceTopology, intentions []*api.Intention) backend.DataResponse {
+	frame := data.NewFrame("topology",
+		data.NewField("service", nil, []string{}),
+		data.NewField("instances", nil, []int64{}),
+		data.NewField("upstream", nil, []string{}),
+		data.NewField("action", nil, []string{}),
+	)
+	for _, service := range topology {
+		if len(service.upstreams) == 0 {
+			frame.AppendRow(service.name, int64(service.instances), "", "")
+			continue
+		}
+		for _, upstream := range service.upstreams {
+			frame.AppendRow(service.name, int64(service.instances), upstream, intentionDecision(intentions, service.name, upstream))
+		}
+	}
+	return backend.DataResponse{Frames: []*data.Frame{frame}}
+}
+
+func generateNodeGraphFromTopology(topology []*serviceTopology, intentions []*api.Intention) backend.DataResponse {
+	graph := newNodeGraph()
+	for _, service := range topology {
+		graph.addNode(service.name, service.instances)
+		for _, upstream := range service.upstreams {
+			graph.addEdge(service.name, upstream, intentionDecision(intentions, service.name, upstream))
+		}
+	}
+	return graph.response()
+}
+
+// nodeGraph collects the nodes and edges of a node graph, nodes and edges are only added once
+type nodeGraph struct {
+	nodes *data.Frame
+	edges *data.Frame
+	ids   map[string]bool
+}
+
+func newNodeGraph() *nodeGraph {
+	nodes := data.NewFrame("nodes",
+		data.NewField("id", nil, []string{}),
+		data.NewField("title", nil, []string{}),
+		data.NewField("mainStat", nil, []int64{}),
+	)
+	nodes.Fields[2].Config = &data.FieldConfig{DisplayName: "instances"}
+	edges := data.NewFrame("edges",
+		data.NewField("id", nil, []string{}),
+		data.NewField("source", nil, []string{}),
+		data.NewField("target", nil, []string{}),
+		data.NewField("mainStat", nil, []string{}),
+	)
+	edges.Fields[3].Config = &data.FieldConfig{DisplayName: "action"}
+	return &nodeGraph{nodes: nodes, edges: edges, ids: map[string]bool{}}
+}
+
+func (g *nodeGraph) addNode(id string, instances int) {
+	if g.ids[id] {
+		return
+	}
+	g.ids[id] = true
+	g.nodes.AppendRow(id, id, int64(instances))
+}
+
+func (g *nodeGraph) addEdge(source, target, action string) {
+	id := source + "->" + target
+	if g.ids[id] {
+		return
+	}
+	g.ids[id] = true
+	g.edges.AppendRow(id, source, target, action)
+}
+
+// response returns the nodes and edges frames, marked for the node graph visualization
+func (g *nodeGraph) response() backend.DataResponse {
+	for _, frame := range []*data.Frame{g.nodes, g.edges} {
+		frame.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeNodeGraph}
+	}
+	return backend.DataResponse{Frames: []*data.Frame{g.nodes, g.edges}}
+}
+
+// queryCARoots returns the Connect CA root certificates with their expiry dates.
+// Time series contain the seconds until each root certificate expires.
+func queryCARoots(ctx context.Context, consul *api.Client, query queryModel, opts *api.QueryOptions) backend.DataResponse {
+	log.DefaultLogger.Debug("queryCARoots", "query", query)
+
+	roots, _, err := consul.Connect().CARoots(opts.WithContext(ctx))
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error consul ca roots: %v", err)}
+	}
+
+	certificates := make([]*x509.Certificate, len(roots.Roots))
+	for i, root := range roots.Roots {
+		if certificates[i], err = parseCertificate(root.RootCertPEM); err != nil {
+			return backend.DataResponse{Error: fmt.Errorf("error parsing ca root %s: %v", root.ID, err)}
+		}
+	}
+
+	now := time.Now()
+	switch query.Format {
+	case "", "timeseries":
+		response := backend.DataResponse{}
+		for i, root := range roots.Roots {
+			labels := data.Labels{"id": root.ID, "name": root.Name, "active": fmt.Sprint(root.Active)}
+			response.Frames = append(response.Frames, data.NewFrame(root.ID,
+				data.NewField("time", nil, []time.Time{now}),
+				data.NewField("values", labels, []float64{certificates[i].NotAfter.Sub(now).Seconds()}),
+			))
+		}
+		return response
+	case "table":
+		frame := data.NewFrame("caroots",
+			data.NewField("id", nil, []string{}),
+			data.NewField("name", nil, []string{}),
+			data.NewField("trustDomain", nil, []string{}),
+			data.NewField("active", nil, []bool{}),
+			data.NewField("notBefore", nil, []time.Time{}),
+			data.NewField("notAfter", nil, []time.Time{}),
+			data.NewField("expiresIn", nil, []float64{}),
+		)
+		frame.Fields[6].Config = &data.FieldConfig{Unit: "s"}
+		for i, root := range roots.Roots {
+			frame.AppendRow(root.ID, root.Name, roots.TrustDomain, root.Active,
+				certificates[i].NotBefore, certificates[i].NotAfter, certificates[i].NotAfter.Sub(now).Seconds())
+		}
+		return backend.DataResponse{Frames: []*data.Frame{frame}}
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown format %s", query.Format)}
+}
+
+func parseCertificate(certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
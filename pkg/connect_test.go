@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/sdk/testutil"
+)
+
+// registerTestConnectServices registers web, api and db with sidecar proxies. web may call api, nobody may call db.
+func registerTestConnectServices(t *testing.T, srv *testutil.TestServer, consul *api.Client) {
+	srv.WaitForActiveCARoot(t)
+
+	for _, service := range []*api.AgentServiceRegistration{
+		{Name: "web", Port: 8080},
+		{Name: "api", Port: 8081},
+		{Name: "db", Port: 5432},
+		{
+			Kind: api.ServiceKindConnectProxy, Name: "web-sidecar-proxy", Port: 21000,
+			Proxy: &api.AgentServiceConnectProxyConfig{
+				DestinationServiceName: "web",
+				Upstreams:              []api.Upstream{{DestinationName: "api", LocalBindPort: 9191}},
+			},
+		},
+		{
+			Kind: api.ServiceKindConnectProxy, Name: "api-sidecar-proxy", Port: 21001,
+			Proxy: &api.AgentServiceConnectProxyConfig{
+				DestinationServiceName: "api",
+				Upstreams:              []api.Upstream{{DestinationName: "db", LocalBindPort: 9192}},
+			},
+		},
+	} {
+		if err := consul.Agent().ServiceRegister(service); err != nil {
+			t.Fatalf("could not register service %s: %v", service.Name, err)
+		}
+	}
+	for destination, sources := range map[string][]*api.SourceIntention{
+		"api": {{Name: "web", Action: api.IntentionActionAllow}},
+		"db":  {{Name: "*", Action: api.IntentionActionDeny}},
+	} {
+		entry := &api.ServiceIntentionsConfigEntry{Kind: api.ServiceIntentions, Name: destination, Sources: sources}
+		if _, _, err := consul.ConfigEntries().Set(entry, nil); err != nil {
+			t.Fatalf("could not create intentions for %s: %v", destination, err)
+		}
+	}
+}
+
+func TestQueryConnect(t *testing.T) {
+	_, _, instance := sharedTestServer(t)
+
+	response := query(context.TODO(), instance, map[string]queryModel{
+		"intentions":          {Format: "table", Type: "intentions"},
+		"intentionsTarget":    {Format: "timeseries", Type: "intentions", Target: "web"},
+		"intentionsNodeGraph": {Format: "nodegraph", Type: "intentions"},
+		"topology":            {Format: "table", Type: "topology"},
+		"topologyNodeGraph":   {Format: "nodegraph", Type: "topology"},
+		"caroots":             {Format: "table", Type: "caroots"},
+		"carootsTimeseries":   {Format: "timeseries", Type: "caroots"},
+	})
+
+	t.Run("intentions", func(t *testing.T) {
+		res := response.Responses["intentions"]
+		if res.Error != nil || len(res.Frames) != 1 || res.Frames[0].Rows() != 2 {
+			t.Fatalf("expected two intentions, got error %v", res.Error)
+		}
+		actions := map[string]string{}
+		for i := 0; i < res.Frames[0].Rows(); i++ {
+			row := res.Frames[0].RowCopy(i)
+			actions[row[1].(string)+"->"+row[2].(string)] = row[3].(string)
+		}
+		if actions["web->api"] != "allow" || actions["*->db"] != "deny" {
+			t.Errorf("expected intentions web->api and *->db, got %v", actions)
+		}
+	})
+
+	t.Run("intentionsTarget", func(t *testing.T) {
+		res := response.Responses["intentionsTarget"]
+		if res.Error != nil || len(res.Frames) != 2 {
+			t.Fatalf("expected a frame per action, got %d frames and error %v", len(res.Frames), res.Error)
+		}
+		for _, frame := range res.Frames {
+			expected := 0.0
+			if frame.Name == "allow" {
+				expected = 1
+			}
+			if value := frame.Fields[1].At(0); value != expected {
+				t.Errorf("expected %v intentions with action %s, got %v", expected, frame.Name, value)
+			}
+		}
+	})
+
+	t.Run("intentionsNodeGraph", func(t *testing.T) {
+		res := response.Responses["intentionsNodeGraph"]
+		if res.Error != nil || len(res.Frames) != 2 {
+			t.Fatalf("expected nodes and edges, got %d frames and error %v", len(res.Frames), res.Error)
+		}
+		if nodes, edges := res.Frames[0], res.Frames[1]; nodes.Rows() != 4 || edges.Rows() != 2 || edges.Meta.PreferredVisualization != "nodeGraph" {
+			t.Errorf("expected 4 nodes and 2 edges, got %d nodes and %d edges", nodes.Rows(), edges.Rows())
+		}
+	})
+
+	t.Run("topology", func(t *testing.T) {
+		res := response.Responses["topology"]
+		if res.Error != nil || len(res.Frames) != 1 {
+			t.Fatalf("expected one frame, got error %v", res.Error)
+		}
+		upstreams := map[string]string{}
+		for i := 0; i < res.Frames[0].Rows(); i++ {
+			row := res.Frames[0].RowCopy(i)
+			if row[2] != "" {
+				upstreams[row[0].(string)+"->"+row[2].(string)] = row[3].(string)
+			}
+			if row[0] == "web" && row[1] != int64(1) {
+				t.Errorf("expected one instance of web without proxies, got %v", row[1])
+			}
+		}
+		if len(upstreams) != 2 || upstreams["web->api"] != "allow" || upstreams["api->db"] != "deny" {
+			t.Errorf("expected upstreams web->api and api->db, got %v", upstreams)
+		}
+	})
+
+	t.Run("topologyNodeGraph", func(t *testing.T) {
+		res := response.Responses["topologyNodeGraph"]
+		if res.Error != nil || len(res.Frames) != 2 {
+			t.Fatalf("expected nodes and edges, got %d frames and error %v", len(res.Frames), res.Error)
+		}
+		if edges := res.Frames[1]; edges.Rows() != 2 || edges.Fields[1].At(0) != "api" || edges.Fields[2].At(0) != "db" {
+			t.Errorf("expected edges api->db and web->api, got %v", edges.Fields)
+		}
+	})
+
+	t.Run("caroots", func(t *testing.T) {
+		res := response.Responses["caroots"]
+		if res.Error != nil || len(res.Frames) != 1 || res.Frames[0].Rows() != 1 {
+			t.Fatalf("expected one CA root, got error %v", res.Error)
+		}
+		if row := res.Frames[0].RowCopy(0); row[3] != true || row[6].(float64) <= 0 {
+			t.Errorf("expected an active root which is not expired, got %v", row)
+		}
+		series := response.Responses["carootsTimeseries"]
+		if series.Error != nil || len(series.Frames) != 1 || series.Frames[0].Fields[1].Labels["active"] != "true" {
+			t.Errorf("expected a series for the active root, got error %v", series.Error)
+		}
+	})
+}
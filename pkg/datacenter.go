@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// allDatacenters is the datacenter of queries which are executed in every datacenter
+const allDatacenters = "*"
+
+// queryAllDatacenters executes the query in every datacenter known to the Consul catalog and
+// labels the frames with their datacenter.
+func queryAllDatacenters(ctx context.Context, instance *instanceSettings, query queryModel) backend.DataResponse {
+	log.DefaultLogger.Debug("queryAllDatacenters", "query", query)
+
+	var datacenters []string
+	err := limitRequest(ctx, func() error {
+		var err error
+		datacenters, err = instance.consul.Catalog().Datacenters()
+		return err
+	})
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error consul catalog datacenters: %v", err)}
+	}
+	sort.Strings(datacenters)
+
+	return fanOut("datacenter", datacenters, func(datacenter string) backend.DataResponse {
+		dcQuery := query
+		dcQuery.Datacenter = datacenter
+		return runDatacenterQuery(ctx, instance, dcQuery)
+	})
+}
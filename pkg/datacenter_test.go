@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestQueryDatacenters(t *testing.T) {
+	srv, consul := setupTestServer(t)
+	defer srv.Stop()
+
+	instance, err := newInstanceSettings(consul, jsonData{Datacenter: "default"})
+	if err != nil {
+		t.Fatalf("could not create instance: %v", err)
+	}
+
+	target := "registry/apiregistration.k8s.io/apiservices/v1.apps/spec/groupPriorityMinimum"
+	response := query(context.TODO(), instance, map[string]queryModel{
+		"default": {Format: "timeseries", Type: "get", Target: target},
+		"all":     {Format: "timeseries", Type: "get", Target: target, Datacenter: allDatacenters},
+		"unknown": {Format: "timeseries", Type: "get", Target: target, Datacenter: "unknown"},
+	})
+
+	if res := response.Responses["default"]; res.Error != nil || len(res.Frames) != 1 {
+		t.Errorf("default datacenter: expected one frame, got %d frames and error %v", len(res.Frames), res.Error)
+	}
+
+	res := response.Responses["all"]
+	if res.Error != nil || len(res.Frames) != 1 {
+		t.Fatalf("all datacenters: expected one frame, got %d frames and error %v", len(res.Frames), res.Error)
+	}
+	if dc := res.Frames[0].Fields[1].Labels["datacenter"]; dc != "default" {
+		t.Errorf("all datacenters: expected datacenter label default, got %q", dc)
+	}
+
+	if res := response.Responses["unknown"]; res.Error == nil {
+		t.Errorf("unknown datacenter: expected error")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// fanOut executes run in parallel for every value and labels the frames of each response with
+// label=value. If some executions fail, the frames of the others are returned together with the errors.
+// The requests to Consul are limited by the request limiter of the query, which is shared by nested fan-outs.
+func fanOut(label string, values []string, run func(value string) backend.DataResponse) backend.DataResponse {
+	responses := make([]backend.DataResponse, len(values))
+	var wg sync.WaitGroup
+	for i, value := range values {
+		wg.Add(1)
+		go func(i int, value string) {
+			defer wg.Done()
+			responses[i] = run(value)
+		}(i, value)
+	}
+	wg.Wait()
+
+	response := backend.DataResponse{}
+	var errs []string
+	for i, value := range values {
+		if responses[i].Error != nil {
+			errs = append(errs, fmt.Sprintf("%s %s: %v", label, value, responses[i].Error))
+			continue
+		}
+		response.Frames = append(response.Frames, labelFrames(responses[i].Frames, label, value)...)
+	}
+	if len(errs) > 0 {
+		response.Error = fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	return response
+}
+
+// labelFrames adds a label to all fields except the time fields of frames.
+// Long time series frames have no labels, they get a string field with the value after the time field instead.
+// The fields are copied, so cached frames are not changed.
+func labelFrames(frames []*data.Frame, name, value string) []*data.Frame {
+	for _, frame := range frames {
+		if frame.Meta != nil && frame.Meta.Type == data.FrameTypeTimeSeriesLong && len(frame.Fields) > 0 {
+			values := make([]string, frame.Fields[0].Len())
+			for i := range values {
+				values[i] = value
+			}
+			fields := []*data.Field{frame.Fields[0], data.NewField(name, nil, values)}
+			frame.Fields = append(fields, frame.Fields[1:]...)
+			continue
+		}
+
+		for i, field := range frame.Fields {
+			if field.Type() == data.FieldTypeTime || field.Type() == data.FieldTypeNullableTime {
+				continue
+			}
+
+			labels := data.Labels{name: value}
+			for k, v := range field.Labels {
+				labels[k] = v
+			}
+			labeled := *field
+			labeled.Labels = labels
+			frame.Fields[i] = &labeled
+		}
+	}
+	return frames
+}
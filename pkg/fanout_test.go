@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/hashicorp/consul/api"
+)
+
+func TestNestedFanOutRequestLimit(t *testing.T) {
+	transport := &countingTransport{}
+	conf := api.DefaultConfig()
+	conf.Address = "counting"
+	conf.HttpClient = &http.Client{Transport: transport}
+	consul, err := newConsulClient(conf)
+	if err != nil {
+		t.Fatalf("error creating consul client: %v", err)
+	}
+	instance, err := newInstanceSettings(consul, jsonData{Concurrency: 2})
+	if err != nil {
+		t.Fatalf("error creating instance: %v", err)
+	}
+
+	// every variable value is queried in every datacenter and in every namespace
+	response := runQuery(context.TODO(), instance, queryModel{
+		Type:       "get",
+		Target:     "apps/$app/replicas",
+		Datacenter: allDatacenters,
+		Namespace:  allNamespaces,
+		ScopedVars: map[string]scopedVar{"app": {Value: variableValues{"api", "db", "web"}}},
+	})
+	if response.Error != nil {
+		t.Fatalf("unexpected error: %v", response.Error)
+	}
+
+	if len(response.Frames) != 27 {
+		t.Errorf("expected 27 frames, got %d", len(response.Frames))
+	}
+	if transport.maxInFlight > 2 {
+		t.Errorf("expected at most 2 parallel requests, got %d", transport.maxInFlight)
+	}
+}
+
+// countingTransport answers the requests of a Consul client with three datacenters and three namespaces
+// and counts how many requests are in flight at the same time.
+type countingTransport struct {
+	inFlight, maxInFlight int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	current := atomic.AddInt32(&t.inFlight, 1)
+	defer atomic.AddInt32(&t.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&t.maxInFlight)
+		if current <= max || atomic.CompareAndSwapInt32(&t.maxInFlight, max, current) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	var body interface{}
+	switch {
+	case req.URL.Path == "/v1/catalog/datacenters":
+		body = []string{"dc1", "dc2", "dc3"}
+	case req.URL.Path == "/v1/namespaces":
+		body = []*api.Namespace{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	case strings.HasPrefix(req.URL.Path, "/v1/kv/"):
+		body = []*api.KVPair{{Key: strings.TrimPrefix(req.URL.Path, "/v1/kv/"), Value: []byte("1")}}
+	default:
+		return nil, fmt.Errorf("unexpected request %s", req.URL)
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set("X-Consul-Index", "1")
+	header.Set("X-Consul-KnownLeader", "true")
+	header.Set("X-Consul-LastContact", "0")
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewReader(encoded)),
+		Request:    req,
+	}, nil
+}
+
+func TestLabelFrames(t *testing.T) {
+	values := data.NewField("values", data.Labels{"node": "node1"}, []float64{1})
+	frame := data.NewFrame("key",
+		data.NewField("time", nil, []time.Time{time.Now()}),
+		values,
+	)
+
+	labelFrames([]*data.Frame{frame}, "datacenter", "dc1")
+
+	if frame.Fields[0].Labels != nil {
+		t.Errorf("expected no labels on time field, got %v", frame.Fields[0].Labels)
+	}
+	if labels := frame.Fields[1].Labels; labels["datacenter"] != "dc1" || labels["node"] != "node1" {
+		t.Errorf("unexpected labels %v", labels)
+	}
+	if _, ok := values.Labels["datacenter"]; ok {
+		t.Errorf("expected labels of the original field to be unchanged, got %v", values.Labels)
+	}
+}
+
+func TestLabelLongFrames(t *testing.T) {
+	frame := longSeriesFrame("key", []alertSeries{
+		{labels: data.Labels{"key": "a"}, value: 1},
+		{labels: data.Labels{"key": "b"}, value: 2},
+	})
+
+	labelFrames([]*data.Frame{frame}, "datacenter", "dc1")
+
+	if len(frame.Fields) != 4 || frame.Fields[1].Name != "datacenter" || frame.Fields[1].At(1) != "dc1" {
+		t.Fatalf("expected datacenter field after the time field, got %v", frame.Fields)
+	}
+	if frame.Fields[3].Labels != nil {
+		t.Errorf("expected no labels on value field, got %v", frame.Fields[3].Labels)
+	}
+}
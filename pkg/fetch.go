@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/hashicorp/consul/api"
+)
+
+// defaultConcurrency is the default number of concurrent requests to Consul per query
+const defaultConcurrency = 10
+
+// fetchKVs returns the KV pairs of keys. Keys which don't exist are not part of the result.
+// If the keys were listed recursively and share a common folder, all KV pairs below it are fetched with one
+// list request. Otherwise, e.g. for the direct subkeys of a folder whose subtree may be much larger, the keys
+// are fetched with up to concurrency parallel get requests.
+func fetchKVs(ctx context.Context, consul *api.Client, keys []string, recursive bool, concurrency int, opts *api.QueryOptions) (map[string]*api.KVPair, error) {
+	keys = uniqueKeys(keys)
+	if len(keys) == 0 {
+		return map[string]*api.KVPair{}, nil
+	}
+
+	if prefix := folderPrefix(keys); recursive && len(keys) > 1 && prefix != "" {
+		return fetchKVsWithList(ctx, consul, prefix, keys, opts)
+	}
+	return fetchKVsWithWorkers(ctx, consul, keys, concurrency, opts)
+}
+
+// fetchKVsWithList lists all KV pairs below prefix and returns the ones of keys.
+func fetchKVsWithList(ctx context.Context, consul *api.Client, prefix string, keys []string, opts *api.QueryOptions) (map[string]*api.KVPair, error) {
+	log.DefaultLogger.Debug("fetchKVsWithList", "prefix", prefix, "keys", len(keys))
+
+	kvs, _, err := consul.KV().List(prefix, opts.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := map[string]bool{}
+	for _, key := range keys {
+		wanted[key] = true
+	}
+
+	result := map[string]*api.KVPair{}
+	for _, kv := range kvs {
+		if wanted[kv.Key] {
+			result[kv.Key] = kv
+		}
+	}
+	return result, nil
+}
+
+// fetchKVsWithWorkers fetches the keys with a pool of concurrency workers.
+// The first error cancels the remaining requests.
+func fetchKVsWithWorkers(ctx context.Context, consul *api.Client, keys []string, concurrency int, opts *api.QueryOptions) (map[string]*api.KVPair, error) {
+	log.DefaultLogger.Debug("fetchKVsWithWorkers", "keys", len(keys), "concurrency", concurrency)
+
+	values, err := fetchConcurrently(ctx, keys, concurrency, func(ctx context.Context, key string) (interface{}, error) {
+		kv, _, err := consul.KV().Get(key, opts.WithContext(ctx))
+		if kv == nil {
+			return nil, err
+		}
+		return kv, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]*api.KVPair{}
+	for key, value := range values {
+		result[key] = value.(*api.KVPair)
+	}
+	return result, nil
+}
+
+// fetchConcurrently calls fetch for every name with a pool of concurrency workers and returns the values
+// by name. Names whose value is nil are not part of the result. The first error cancels the remaining calls.
+func fetchConcurrently(ctx context.Context, names []string, concurrency int, fetch func(ctx context.Context, name string) (interface{}, error)) (map[string]interface{}, error) {
+	if concurrency < 1 {
+		concurrency = defaultConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	nameCh := make(chan string)
+	go func() {
+		defer close(nameCh)
+		for _, name := range names {
+			select {
+			case nameCh <- name:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+		result   = map[string]interface{}{}
+	)
+	for i := 0; i < concurrency && i < len(names); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range nameCh {
+				value, err := fetch(ctx, name)
+
+				mu.Lock()
+				switch {
+				case err != nil && firstErr == nil:
+					firstErr = err
+					cancel()
+				case err == nil && value != nil:
+					result[name] = value
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return result, ctx.Err()
+}
+
+// folderPrefix returns the common prefix of keys which ends with a /
+func folderPrefix(keys []string) string {
+	prefix := commonPrefix(keys)
+	return prefix[:strings.LastIndex(prefix, "/")+1]
+}
+
+// commonPrefix returns the longest common prefix of keys
+func commonPrefix(keys []string) string {
+	prefix := keys[0]
+	for _, key := range keys[1:] {
+		for !strings.HasPrefix(key, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+func uniqueKeys(keys []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, key)
+		}
+	}
+	return unique
+}
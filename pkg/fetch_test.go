@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func TestCommonPrefix(t *testing.T) {
+	tests := []struct {
+		keys     []string
+		expected string
+	}{
+		{keys: []string{"a/b/c"}, expected: "a/b/c"},
+		{keys: []string{"a/b/c", "a/b/d"}, expected: "a/b/"},
+		{keys: []string{"a/b", "a/bc"}, expected: "a/b"},
+		{keys: []string{"a/b", "c/d"}, expected: ""},
+	}
+	for _, tt := range tests {
+		if prefix := commonPrefix(tt.keys); prefix != tt.expected {
+			t.Errorf("commonPrefix(%v): expected %q, got %q", tt.keys, tt.expected, prefix)
+		}
+	}
+}
+
+func TestFolderPrefix(t *testing.T) {
+	tests := []struct {
+		keys     []string
+		expected string
+	}{
+		{keys: []string{"a/b/c", "a/b/d"}, expected: "a/b/"},
+		{keys: []string{"a/b", "a/bc"}, expected: "a/"},
+		{keys: []string{"aa/x", "ab/y"}, expected: ""},
+	}
+	for _, tt := range tests {
+		if prefix := folderPrefix(tt.keys); prefix != tt.expected {
+			t.Errorf("folderPrefix(%v): expected %q, got %q", tt.keys, tt.expected, prefix)
+		}
+	}
+}
+
+func TestFetchKVs(t *testing.T) {
+	srv, consul := setupTestServer(t)
+	defer srv.Stop()
+
+	keys := []string{
+		"deployments/api/name",
+		"deployments/web/name",
+		"deployments/web/name",
+		"deployments/missing/name",
+		"registry/apiregistration.k8s.io/apiservices/v1.apps/name",
+	}
+	expected := map[string]string{
+		"deployments/api/name": "api",
+		"deployments/web/name": "web",
+		"registry/apiregistration.k8s.io/apiservices/v1.apps/name": "v1.apps",
+	}
+
+	tests := []struct {
+		name      string
+		keys      []string
+		recursive bool
+	}{
+		// keys without a common prefix are fetched with parallel gets
+		{name: "workers", keys: keys, recursive: true},
+		// keys which are not listed recursively are fetched with parallel gets
+		{name: "direct subkeys", keys: keys[:4]},
+		// recursively listed keys with a common folder are fetched with one list
+		{name: "list", keys: keys[:4], recursive: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kvs, err := fetchKVs(context.TODO(), consul, tt.keys, tt.recursive, 2, &api.QueryOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, key := range uniqueKeys(tt.keys) {
+				value, ok := expected[key]
+				kv := kvs[key]
+				switch {
+				case !ok && kv != nil:
+					t.Errorf("key %s: expected no kv, got %s", key, kv.Value)
+				case ok && kv == nil:
+					t.Errorf("key %s: expected %s, got no kv", key, value)
+				case ok && string(kv.Value) != value:
+					t.Errorf("key %s: expected %s, got %s", key, value, kv.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchKVsCancelled(t *testing.T) {
+	srv, consul := setupTestServer(t)
+	defer srv.Stop()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	_, err := fetchKVsWithWorkers(ctx, consul, []string{"deployments/api/name", "deployments/web/name"}, 2, &api.QueryOptions{})
+	if err == nil {
+		t.Errorf("expected error for cancelled context")
+	}
+}
+
+func TestFetchConcurrentlyFirstError(t *testing.T) {
+	_, err := fetchConcurrently(context.TODO(), []string{"a", "b", "c"}, 1, func(ctx context.Context, name string) (interface{}, error) {
+		if name == "a" {
+			return nil, fmt.Errorf("error fetching %s", name)
+		}
+		if ctx.Err() == nil {
+			t.Errorf("expected the first error to cancel the fetch of %s", name)
+		}
+		return name, nil
+	})
+	if err == nil || err.Error() != "error fetching a" {
+		t.Errorf("expected the first error, got %v", err)
+	}
+}
+
+// BenchmarkFetchKVs compares fetching all column values of the k8s test data
+// sequentially, with a pool of workers and with one list request.
+func BenchmarkFetchKVs(b *testing.B) {
+	srv, consul := setupTestServer(b)
+	defer srv.Stop()
+
+	keys, _, err := consul.KV().Keys("registry/", "", nil)
+	if err != nil {
+		b.Fatalf("could not get keys: %v", err)
+	}
+
+	benchmarks := []struct {
+		name  string
+		fetch func() (map[string]*api.KVPair, error)
+	}{
+		{name: "sequential", fetch: func() (map[string]*api.KVPair, error) {
+			return fetchKVsWithWorkers(context.TODO(), consul, keys, 1, &api.QueryOptions{})
+		}},
+		{name: "workers", fetch: func() (map[string]*api.KVPair, error) {
+			return fetchKVsWithWorkers(context.TODO(), consul, keys, defaultConcurrency, &api.QueryOptions{})
+		}},
+		{name: "list", fetch: func() (map[string]*api.KVPair, error) {
+			return fetchKVsWithList(context.TODO(), consul, commonPrefix(keys), keys, &api.QueryOptions{})
+		}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				kvs, err := bm.fetch()
+				if err != nil {
+					b.Fatalf("unexpected error: %v", err)
+				}
+				if len(kvs) != len(keys) {
+					b.Fatalf("expected %d kvs, got %d", len(keys), len(kvs))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkQueryTable(b *testing.B) {
+	srv, consul := setupTestServer(b)
+	defer srv.Stop()
+
+	query := queryModel{
+		Format:  "table",
+		Target:  "registry/apiregistration.k8s.io/apiservices/*/name",
+		Columns: "../name,../kind,../apiVersion,../spec/group,../spec/version,../spec/groupPriorityMinimum,../spec/versionPriority",
+	}
+	for i := 0; i < b.N; i++ {
+		if response := queryTable(context.TODO(), consul, query, defaultConcurrency, &api.QueryOptions{}); response.Error != nil {
+			b.Fatalf("unexpected error: %v", response.Error)
+		}
+	}
+}
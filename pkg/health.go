@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/hashicorp/consul/api"
+)
+
+// healthStateValues maps the check states to numeric values, so they can be used in time series and alerts
+var healthStateValues = map[string]float64{
+	api.HealthPassing:  0,
+	api.HealthWarning:  1,
+	api.HealthCritical: 2,
+	api.HealthMaint:    3,
+}
+
+func queryHealth(ctx context.Context, consul *api.Client, query queryModel, opts *api.QueryOptions) backend.DataResponse {
+	log.DefaultLogger.Debug("queryHealth", "query", query)
+
+	opts, err := catalogQueryOptions(ctx, query, opts)
+	if err != nil {
+		return backend.DataResponse{Error: err}
+	}
+
+	checks, err := getHealthChecks(consul, query.HealthFilter, query.Target, opts)
+	if err != nil {
+		return backend.DataResponse{Error: err}
+	}
+
+	// sort checks, so the rows and series are stable across queries
+	sort.Slice(checks, func(i, j int) bool {
+		if checks[i].Node != checks[j].Node {
+			return checks[i].Node < checks[j].Node
+		}
+		return checks[i].CheckID < checks[j].CheckID
+	})
+
+	switch query.Format {
+	case "", "timeseries":
+		return generateDataResponseFromChecks(checks)
+	case "table":
+		return generateTableFromChecks(checks)
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown format %s", query.Format)}
+}
+
+// getHealthChecks returns the checks of a service, a node or with a check ID.
+// If no filter is set all checks are returned.
+func getHealthChecks(consul *api.Client, filter, target string, opts *api.QueryOptions) (api.HealthChecks, error) {
+	log.DefaultLogger.Debug("getHealthChecks", "filter", filter, "target", target)
+
+	if filter != "" && target == "" {
+		return nil, fmt.Errorf("target should not be empty when filtering checks by %s", filter)
+	}
+
+	switch filter {
+	case "service":
+		checks, _, err := consul.Health().Checks(target, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error consul health checks %s: %v", target, err)
+		}
+		return checks, nil
+	case "node":
+		checks, _, err := consul.Health().Node(target, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error consul health node %s: %v", target, err)
+		}
+		return checks, nil
+	case "", "check":
+		checks, _, err := consul.Health().State(api.HealthAny, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error consul health state: %v", err)
+		}
+		if filter == "" {
+			return checks, nil
+		}
+
+		var matchingChecks api.HealthChecks
+		for _, check := range checks {
+			if check.CheckID == target {
+				matchingChecks = append(matchingChecks, check)
+			}
+		}
+		return matchingChecks, nil
+	}
+	return nil, fmt.Errorf("unknown health filter %s", filter)
+}
+
+// checkState returns the state of a check. Consul reports maintenance mode as critical check,
+// which is mapped to the maintenance state.
+func checkState(check *api.HealthCheck) string {
+	if check.CheckID == api.NodeMaint || strings.HasPrefix(check.CheckID, api.ServiceMaintPrefix) {
+		return api.HealthMaint
+	}
+	return check.Status
+}
+
+func checkLabels(check *api.HealthCheck) data.Labels {
+	return data.Labels{
+		"node":    check.Node,
+		"service": check.ServiceName,
+		"check":   check.CheckID,
+	}
+}
+
+func generateDataResponseFromChecks(checks api.HealthChecks) backend.DataResponse {
+	log.DefaultLogger.Debug("generateDataResponseFromChecks", "checks", checks)
+
+	response := backend.DataResponse{}
+
+	for _, check := range checks {
+		state := checkState(check)
+		stateValue, ok := healthStateValues[state]
+		if !ok {
+			return backend.DataResponse{Error: fmt.Errorf("unknown state %s of check %s", state, check.CheckID)}
+		}
+
+		now := time.Now()
+		value := []float64{stateValue}
+		labels := checkLabels(check)
+		log.DefaultLogger.Debug("appending data frame to response", "name", check.CheckID, "time", now, "value", value, "labels", labels)
+		response.Frames = append(response.Frames, data.NewFrame(check.CheckID,
+			data.NewField("time", nil, []time.Time{now}),
+			data.NewField("values", labels, value),
+		))
+	}
+	return response
+}
+
+func generateTableFromChecks(checks api.HealthChecks) backend.DataResponse {
+	log.DefaultLogger.Debug("generateTableFromChecks", "checks", checks)
+
+	frame := data.NewFrame("checks",
+		data.NewField("node", nil, []string{}),
+		data.NewField("service", nil, []string{}),
+		data.NewField("serviceID", nil, []string{}),
+		data.NewField("check", nil, []string{}),
+		data.NewField("name", nil, []string{}),
+		data.NewField("state", nil, []string{}),
+		data.NewField("value", nil, []float64{}),
+		data.NewField("output", nil, []string{}),
+	)
+	for _, check := range checks {
+		state := checkState(check)
+		frame.AppendRow(check.Node, check.ServiceName, check.ServiceID, check.CheckID, check.Name, state, healthStateValues[state], check.Output)
+	}
+	return backend.DataResponse{Frames: []*data.Frame{frame}}
+}
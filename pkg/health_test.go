@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func TestGenerateDataResponseFromChecks(t *testing.T) {
+	checks := api.HealthChecks{
+		{Node: "node1", CheckID: "serfHealth", Status: api.HealthPassing},
+		{Node: "node1", CheckID: "service:web", ServiceName: "web", Status: api.HealthWarning},
+		{Node: "node2", CheckID: "service:web", ServiceName: "web", Status: api.HealthCritical},
+		{Node: "node2", CheckID: api.ServiceMaintPrefix + "web", ServiceName: "web", Status: api.HealthCritical},
+		{Node: "node3", CheckID: api.NodeMaint, Status: api.HealthCritical},
+	}
+	expected := []float64{0, 1, 2, 3, 3}
+
+	response := generateDataResponseFromChecks(checks)
+	if response.Error != nil {
+		t.Fatalf("unexpected error: %v", response.Error)
+	}
+	if len(response.Frames) != len(checks) {
+		t.Fatalf("expected %d frames, got %d", len(checks), len(response.Frames))
+	}
+
+	for i, frame := range response.Frames {
+		field := frame.Fields[1]
+		if value := field.At(0); value != expected[i] {
+			t.Errorf("check %s on %s: expected value %v, got %v", checks[i].CheckID, checks[i].Node, expected[i], value)
+		}
+		if field.Labels["node"] != checks[i].Node || field.Labels["check"] != checks[i].CheckID || field.Labels["service"] != checks[i].ServiceName {
+			t.Errorf("check %s on %s: unexpected labels %v", checks[i].CheckID, checks[i].Node, field.Labels)
+		}
+	}
+}
+
+func TestGenerateDataResponseFromChecksUnknownState(t *testing.T) {
+	response := generateDataResponseFromChecks(api.HealthChecks{{Node: "node1", CheckID: "serfHealth", Status: "unknown"}})
+	if response.Error == nil {
+		t.Errorf("expected error for unknown state")
+	}
+}
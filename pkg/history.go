@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/hashicorp/consul/api"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// defaultHistoryRetention is the default duration samples are kept by the history recorder
+	defaultHistoryRetention = 7 * 24 * time.Hour
+	// historyWaitTime is the wait time of the blocking queries of the history recorder
+	historyWaitTime = 5 * time.Minute
+	// historyRetryInterval is the time the history recorder waits after a failed blocking query
+	historyRetryInterval = 5 * time.Second
+)
+
+// historySample is a value of a key recorded by the history recorder. Deleted samples are recorded
+// when the key is deleted, they have no value.
+type historySample struct {
+	Time        time.Time `json:"-"`
+	Value       string    `json:"value"`
+	ModifyIndex uint64    `json:"modifyIndex"`
+	Deleted     bool      `json:"deleted,omitempty"`
+}
+
+// historyRecorder watches keys with blocking queries and stores every change of their values
+// with the time and the ModifyIndex in a bolt database. Each key has its own bucket, the samples
+// are stored by their time, so they can be read for a time range.
+// Keys ending with / are prefixes, all keys below them are recorded.
+type historyRecorder struct {
+	consul    *api.Client
+	opts      *api.QueryOptions
+	db        *bolt.DB
+	keys      []string
+	retention time.Duration
+
+	mu          sync.Mutex
+	lastIndexes map[string]uint64
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newHistoryRecorder(consul *api.Client, opts *api.QueryOptions, path string, keys []string, retention time.Duration) (*historyRecorder, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening history database %s: %v", path, err)
+	}
+	return &historyRecorder{
+		consul:      consul,
+		opts:        opts,
+		db:          db,
+		keys:        keys,
+		retention:   retention,
+		lastIndexes: map[string]uint64{},
+	}, nil
+}
+
+// start starts watching the keys in the background until stop is called
+func (r *historyRecorder) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	for _, key := range r.keys {
+		r.wg.Add(1)
+		go func(key string) {
+			defer r.wg.Done()
+			r.watch(ctx, key)
+		}(key)
+	}
+}
+
+// stop stops watching the keys and closes the database
+func (r *historyRecorder) stop() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.wg.Wait()
+	if err := r.db.Close(); err != nil {
+		log.DefaultLogger.Error("could not close history database", "err", err)
+	}
+}
+
+// watch records the values of key every time they change
+func (r *historyRecorder) watch(ctx context.Context, key string) {
+	runBlockingQuery(ctx, "history recorder", historyRetryInterval, []interface{}{"key", key}, func(waitIndex uint64) (uint64, func() error, error) {
+		opts := *r.opts
+		opts.WaitIndex = waitIndex
+		opts.WaitTime = historyWaitTime
+
+		kvs, meta, err := r.consul.KV().List(key, opts.WithContext(ctx))
+		if err != nil {
+			return 0, nil, err
+		}
+		return meta.LastIndex, func() error {
+			// List returns all keys with the prefix, only prefixes ending with / select multiple keys
+			var recorded []*api.KVPair
+			for _, kv := range kvs {
+				if strings.HasSuffix(key, "/") || kv.Key == key {
+					recorded = append(recorded, kv)
+				}
+			}
+			if err := r.record(key, recorded, time.Now()); err != nil {
+				log.DefaultLogger.Error("history recorder: could not record values", "key", key, "err", err)
+			}
+			return nil
+		}, nil
+	})
+}
+
+// record stores the values of kvs, the current keys of the watched key, which changed since they were
+// recorded the last time. Recorded keys of the watched key which are missing in kvs were deleted, a deleted
+// sample is stored for them. Samples older than the retention are removed.
+func (r *historyRecorder) record(watched string, kvs []*api.KVPair, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.db.Update(func(tx *bolt.Tx) error {
+		current := map[string]bool{}
+		for _, kv := range kvs {
+			current[kv.Key] = true
+			if err := r.put(tx, kv.Key, historySample{Value: string(kv.Value), ModifyIndex: kv.ModifyIndex}, now); err != nil {
+				return err
+			}
+		}
+
+		// the buckets are sorted by key, so the recorded keys of the watched key follow it
+		var deleted []string
+		c := tx.Cursor()
+		for k, _ := c.Seek([]byte(watched)); k != nil && strings.HasPrefix(string(k), watched); k, _ = c.Next() {
+			key := string(k)
+			if (strings.HasSuffix(watched, "/") || key == watched) && !current[key] {
+				deleted = append(deleted, key)
+			}
+		}
+		for _, key := range deleted {
+			if err := r.put(tx, key, historySample{Deleted: true}, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// put stores the sample of key if its ModifyIndex differs from the last sample. Deleted samples have
+// ModifyIndex 0, so they are only stored once.
+func (r *historyRecorder) put(tx *bolt.Tx, key string, sample historySample, now time.Time) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(key))
+	if err != nil {
+		return err
+	}
+
+	lastIndex, ok := r.lastIndexes[key]
+	if !ok {
+		if _, v := bucket.Cursor().Last(); v != nil {
+			var last historySample
+			if err := json.Unmarshal(v, &last); err == nil {
+				lastIndex = last.ModifyIndex
+			}
+		}
+	}
+	if lastIndex == sample.ModifyIndex {
+		return nil
+	}
+
+	value, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	if err := bucket.Put(historyTimeKey(now), value); err != nil {
+		return err
+	}
+	r.lastIndexes[key] = sample.ModifyIndex
+
+	// deleting with the cursor would skip samples, so the expired samples are collected first
+	var expired [][]byte
+	cutoff := historyTimeKey(now.Add(-r.retention))
+	c := bucket.Cursor()
+	for k, _ := c.First(); k != nil && string(k) < string(cutoff); k, _ = c.Next() {
+		expired = append(expired, k)
+	}
+	for _, k := range expired {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// records returns true if key is recorded
+func (r *historyRecorder) records(key string) bool {
+	for _, recorded := range r.keys {
+		if key == recorded || (strings.HasSuffix(recorded, "/") && strings.HasPrefix(key, recorded)) {
+			return true
+		}
+	}
+	return false
+}
+
+// samples returns the samples of key between from and to. The last sample before from is
+// returned at from, because it is the value the key had at the beginning of the time range.
+func (r *historyRecorder) samples(key string, from, to time.Time) ([]historySample, error) {
+	var samples []historySample
+	err := r.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(key))
+		if bucket == nil {
+			return nil
+		}
+
+		c := bucket.Cursor()
+		fromKey := historyTimeKey(from)
+		k, v := c.Seek(fromKey)
+		var prevK, prevV []byte
+		if k == nil {
+			prevK, prevV = c.Last()
+		} else {
+			prevK, prevV = c.Prev()
+			// Prev moved the cursor, move it back to the first sample in the time range
+			k, v = c.Seek(fromKey)
+		}
+		if prevK != nil {
+			sample, err := decodeHistorySample(prevK, prevV)
+			if err != nil {
+				return err
+			}
+			sample.Time = from
+			samples = append(samples, sample)
+		}
+		for ; k != nil && string(k) <= string(historyTimeKey(to)); k, v = c.Next() {
+			sample, err := decodeHistorySample(k, v)
+			if err != nil {
+				return err
+			}
+			samples = append(samples, sample)
+		}
+		return nil
+	})
+	return samples, err
+}
+
+// parseHistoryKeys parses the comma-separated keys of the history recorder
+func parseHistoryKeys(s string) []string {
+	var keys []string
+	for _, key := range strings.Split(s, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func historyTimeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+func decodeHistorySample(k, v []byte) (historySample, error) {
+	var sample historySample
+	if err := json.Unmarshal(v, &sample); err != nil {
+		return sample, fmt.Errorf("error decoding history sample: %v", err)
+	}
+	sample.Time = time.Unix(0, int64(binary.BigEndian.Uint64(k)))
+	return sample, nil
+}
+
+// queryHistory returns the values the target had in the time range of the query as recorded by
+// the history recorder. Numeric values are returned as numbers, otherwise all values are strings.
+// The values are null while the key was deleted. Only the datacenter, namespace and partition of the
+// datasource are recorded, opts of other ones are rejected.
+func queryHistory(history *historyRecorder, query queryModel, opts *api.QueryOptions) backend.DataResponse {
+	log.DefaultLogger.Debug("queryHistory", "query", query)
+
+	if history == nil {
+		return backend.DataResponse{Error: fmt.Errorf("history is not enabled for the datasource")}
+	}
+	if opts.Datacenter != history.opts.Datacenter || opts.Namespace != history.opts.Namespace || opts.Partition != history.opts.Partition {
+		return backend.DataResponse{Error: fmt.Errorf("history is only recorded for the datacenter, namespace and partition of the datasource")}
+	}
+	if query.Type != "" && query.Type != "get" {
+		return backend.DataResponse{Error: fmt.Errorf("history is not supported for query type %s", query.Type)}
+	}
+
+	target := strings.TrimSuffix(strings.Replace(query.Target, "\\.", ".", -1), "/")
+	if !history.records(target) {
+		return backend.DataResponse{Error: fmt.Errorf("key %s is not recorded", target)}
+	}
+
+	samples, err := history.samples(target, query.TimeRange.From, query.TimeRange.To)
+	if err != nil {
+		return backend.DataResponse{Error: err}
+	}
+
+	times := make([]time.Time, len(samples))
+	strValues := make([]*string, len(samples))
+	floatValues := make([]*float64, len(samples))
+	numeric := true
+	for i, sample := range samples {
+		times[i] = sample.Time
+		if sample.Deleted {
+			continue
+		}
+		value := sample.Value
+		strValues[i] = &value
+		if numeric {
+			floatValue, err := strconv.ParseFloat(strings.TrimSpace(sample.Value), 64)
+			floatValues[i] = &floatValue
+			numeric = err == nil
+		}
+	}
+
+	values := data.NewField("values", nil, strValues)
+	if numeric {
+		values = data.NewField("values", nil, floatValues)
+	}
+	return backend.DataResponse{Frames: []*data.Frame{data.NewFrame(target,
+		data.NewField("time", nil, times),
+		values,
+	)}}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/hashicorp/consul/api"
+)
+
+func historyTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	return dir
+}
+
+func TestHistoryRecorder(t *testing.T) {
+	dir := historyTestDir(t)
+	defer os.RemoveAll(dir)
+
+	history, err := newHistoryRecorder(nil, &api.QueryOptions{}, filepath.Join(dir, "history.db"), []string{"flags/", "deployments/web/replicas"}, time.Hour)
+	if err != nil {
+		t.Fatalf("could not create history recorder: %v", err)
+	}
+	defer history.stop()
+
+	start := time.Now().Add(-2 * time.Hour)
+	record := func(offset time.Duration, value string, modifyIndex uint64) {
+		kv := &api.KVPair{Key: "flags/rollout", Value: []byte(value), ModifyIndex: modifyIndex}
+		if err := history.record("flags/", []*api.KVPair{kv}, start.Add(offset)); err != nil {
+			t.Fatalf("could not record value: %v", err)
+		}
+	}
+	record(0, "10", 1)
+	record(70*time.Minute, "20", 2)
+	// unchanged ModifyIndex, not recorded
+	record(80*time.Minute, "20", 2)
+	record(90*time.Minute, "30", 3)
+	record(100*time.Minute, "40", 4)
+
+	samples, err := history.samples("flags/rollout", start.Add(85*time.Minute), start.Add(95*time.Minute))
+	if err != nil {
+		t.Fatalf("could not read samples: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("expected two samples, got %v", samples)
+	}
+	if samples[0].Value != "20" || !samples[0].Time.Equal(start.Add(85*time.Minute)) {
+		t.Errorf("expected the value at the start of the time range, got %+v", samples[0])
+	}
+	if samples[1].Value != "30" || samples[1].ModifyIndex != 3 || !samples[1].Time.Equal(start.Add(90*time.Minute)) {
+		t.Errorf("expected the value recorded in the time range, got %+v", samples[1])
+	}
+
+	// the first sample is older than the retention
+	samples, err = history.samples("flags/rollout", start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("could not read samples: %v", err)
+	}
+	if len(samples) != 0 {
+		t.Errorf("expected expired samples to be deleted, got %v", samples)
+	}
+
+	// flags/rollout is missing in the list of flags/, it was deleted
+	if err := history.record("flags/", nil, start.Add(110*time.Minute)); err != nil {
+		t.Fatalf("could not record deletion: %v", err)
+	}
+	if err := history.record("flags/", nil, start.Add(115*time.Minute)); err != nil {
+		t.Fatalf("could not record deletion: %v", err)
+	}
+	samples, err = history.samples("flags/rollout", start.Add(105*time.Minute), start.Add(120*time.Minute))
+	if err != nil {
+		t.Fatalf("could not read samples: %v", err)
+	}
+	if len(samples) != 2 || samples[0].Value != "40" || !samples[1].Deleted || !samples[1].Time.Equal(start.Add(110*time.Minute)) {
+		t.Errorf("expected one deleted sample after the value, got %+v", samples)
+	}
+
+	for key, expected := range map[string]bool{"flags/rollout": true, "deployments/web/replicas": true, "deployments/web/name": false} {
+		if actual := history.records(key); actual != expected {
+			t.Errorf("records(%s): expected %v, got %v", key, expected, actual)
+		}
+	}
+}
+
+func TestQueryHistory(t *testing.T) {
+	srv, consul := setupTestServer(t)
+	defer srv.Stop()
+
+	key := "deployments/web/replicas"
+	put := func(value string) {
+		if _, err := consul.KV().Put(&api.KVPair{Key: key, Value: []byte(value)}, nil); err != nil {
+			t.Fatalf("could not put %s: %v", key, err)
+		}
+	}
+	put("1")
+
+	dir := historyTestDir(t)
+	defer os.RemoveAll(dir)
+
+	start := time.Now()
+	instance, err := newInstanceSettings(consul, jsonData{HistoryKeys: key, HistoryPath: filepath.Join(dir, "history.db")})
+	if err != nil {
+		t.Fatalf("could not create instance: %v", err)
+	}
+	defer instance.Dispose()
+
+	waitForSamples := func(count int) {
+		for i := 0; i < 50; i++ {
+			samples, err := instance.history.samples(key, start, time.Now())
+			if err == nil && len(samples) >= count {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		t.Fatalf("expected %d samples to be recorded", count)
+	}
+	waitForSamples(1)
+	put("3")
+	waitForSamples(2)
+	if _, err := consul.KV().Delete(key, nil); err != nil {
+		t.Fatalf("could not delete %s: %v", key, err)
+	}
+	waitForSamples(3)
+
+	timeRange := backend.TimeRange{From: start.Add(-time.Hour), To: time.Now()}
+	response := query(context.TODO(), instance, map[string]queryModel{
+		"A":          {Format: "timeseries", Type: "get", Target: key, History: true, TimeRange: timeRange},
+		"unrecorded": {Format: "timeseries", Type: "get", Target: "deployments/web/name", History: true, TimeRange: timeRange},
+		"dc":         {Format: "timeseries", Type: "get", Target: key, Datacenter: "dc2", History: true, TimeRange: timeRange},
+		"all":        {Format: "timeseries", Type: "get", Target: key, Datacenter: "*", History: true, TimeRange: timeRange},
+	})
+
+	res := response.Responses["A"]
+	if res.Error != nil || len(res.Frames) != 1 {
+		t.Fatalf("expected one frame, got %d frames and error %v", len(res.Frames), res.Error)
+	}
+	values := res.Frames[0].Fields[1]
+	first, _ := values.ConcreteAt(0)
+	second, _ := values.ConcreteAt(1)
+	if _, deleted := values.ConcreteAt(2); values.Len() != 3 || first != 1.0 || second != 3.0 || deleted {
+		t.Errorf("expected values 1, 3 and null, got %v", values)
+	}
+
+	if res := response.Responses["unrecorded"]; res.Error == nil {
+		t.Errorf("expected error for a key which is not recorded")
+	}
+	for _, refID := range []string{"dc", "all"} {
+		if res := response.Responses[refID]; res.Error == nil {
+			t.Errorf("%s: expected error for a datacenter which is not recorded", refID)
+		}
+	}
+}
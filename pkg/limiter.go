@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// requestLimiter limits the number of parallel requests of a query to Consul. It is passed to the Consul client
+// with the context of the requests, so all fan-outs of a query share the same limit however deeply they nest.
+type requestLimiter chan struct{}
+
+type requestLimiterKey struct{}
+
+func newRequestLimiter(limit int) requestLimiter {
+	if limit < 1 {
+		limit = defaultConcurrency
+	}
+	return make(requestLimiter, limit)
+}
+
+// withRequestLimiter returns a context whose requests to Consul are limited by limiter
+func withRequestLimiter(ctx context.Context, limiter requestLimiter) context.Context {
+	return context.WithValue(ctx, requestLimiterKey{}, limiter)
+}
+
+// limitedTransport waits for a free slot of the request limiter in the context of a request before sending it.
+// Requests without a request limiter, e.g. the blocking queries of streams and the history, are not limited.
+type limitedTransport struct {
+	next http.RoundTripper
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var resp *http.Response
+	sent := false
+	err := limitRequest(req.Context(), func() error {
+		var err error
+		sent = true
+		resp, err = t.next.RoundTrip(req)
+		return err
+	})
+	// a RoundTripper must close the body even if it doesn't send the request
+	if !sent && req.Body != nil {
+		req.Body.Close()
+	}
+	return resp, err
+}
+
+// limitRequest calls request while holding a slot of the request limiter of ctx. The Consul client limits its
+// requests itself, so this is only needed for the calls of the client which don't take a context.
+func limitRequest(ctx context.Context, request func() error) error {
+	limiter, ok := ctx.Value(requestLimiterKey{}).(requestLimiter)
+	if !ok {
+		return request()
+	}
+
+	select {
+	case limiter <- struct{}{}:
+		defer func() { <-limiter }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return request()
+}
+
+// newConsulClient returns a Consul client whose requests are limited by the request limiter in their context
+func newConsulClient(conf *api.Config) (*api.Client, error) {
+	client, err := api.NewClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	// the client keeps the HTTP client NewClient created in conf
+	conf.HttpClient.Transport = &limitedTransport{next: conf.HttpClient.Transport}
+	return client, nil
+}
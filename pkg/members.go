@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/hashicorp/consul/api"
+)
+
+// memberStatuses are the names of the serf member statuses, the index is the status
+var memberStatuses = []string{"none", "alive", "leaving", "left", "failed"}
+
+// queryMembers returns the members of the LAN or WAN gossip pool of the agent. The target is the
+// LAN segment, it is only supported by Consul Enterprise. The members endpoint only serves the agent of the
+// client, so queries with a datacenter, namespace or partition are rejected.
+// Tables contain a row per member, time series the number of members per status.
+func queryMembers(consul *api.Client, query queryModel) backend.DataResponse {
+	log.DefaultLogger.Debug("queryMembers", "query", query)
+
+	if query.Datacenter != "" || query.Namespace != "" || query.Partition != "" {
+		return backend.DataResponse{Error: fmt.Errorf("members are returned by the agent of the datasource, datacenter, namespace and partition are not supported")}
+	}
+
+	var wan bool
+	switch query.Pool {
+	case "", "lan":
+	case "wan":
+		wan = true
+	default:
+		return backend.DataResponse{Error: fmt.Errorf("unknown gossip pool %s", query.Pool)}
+	}
+
+	members, err := consul.Agent().MembersOpts(api.MembersOpts{WAN: wan, Segment: query.Target})
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error consul agent members: %v", err)}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Name < members[j].Name
+	})
+
+	switch query.Format {
+	case "", "timeseries":
+		return generateDataResponseFromMembers(members)
+	case "table":
+		return generateTableFromMembers(members)
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown format %s", query.Format)}
+}
+
+// generateDataResponseFromMembers returns a series per status with the number of members.
+// All statuses are returned, so the series don't disappear when no member has a status.
+func generateDataResponseFromMembers(members []*api.AgentMember) backend.DataResponse {
+	counts := make([]float64, len(memberStatuses))
+	for _, member := range members {
+		if member.Status >= 0 && member.Status < len(memberStatuses) {
+			counts[member.Status]++
+		}
+	}
+
+	response := backend.DataResponse{}
+	now := time.Now()
+	for status, name := range memberStatuses {
+		response.Frames = append(response.Frames, data.NewFrame(name,
+			data.NewField("time", nil, []time.Time{now}),
+			data.NewField("values", data.Labels{"status": name}, []float64{counts[status]}),
+		))
+	}
+	return response
+}
+
+func generateTableFromMembers(members []*api.AgentMember) backend.DataResponse {
+	frame := data.NewFrame("members",
+		data.NewField("name", nil, []string{}),
+		data.NewField("address", nil, []string{}),
+		data.NewField("port", nil, []int64{}),
+		data.NewField("status", nil, []string{}),
+		data.NewField("role", nil, []string{}),
+		data.NewField("datacenter", nil, []string{}),
+		data.NewField("version", nil, []string{}),
+		data.NewField("segment", nil, []string{}),
+		data.NewField("protocolMin", nil, []int64{}),
+		data.NewField("protocolMax", nil, []int64{}),
+		data.NewField("protocolCur", nil, []int64{}),
+		data.NewField("delegateMin", nil, []int64{}),
+		data.NewField("delegateMax", nil, []int64{}),
+		data.NewField("delegateCur", nil, []int64{}),
+		data.NewField("tags", nil, []string{}),
+	)
+	for _, member := range members {
+		frame.AppendRow(member.Name, member.Addr, int64(member.Port), memberStatus(member.Status),
+			member.Tags["role"], member.Tags["dc"], memberVersion(member), member.Tags["segment"],
+			int64(member.ProtocolMin), int64(member.ProtocolMax), int64(member.ProtocolCur),
+			int64(member.DelegateMin), int64(member.DelegateMax), int64(member.DelegateCur),
+			joinMap(member.Tags))
+	}
+	return backend.DataResponse{Frames: []*data.Frame{frame}}
+}
+
+func memberStatus(status int) string {
+	if status >= 0 && status < len(memberStatuses) {
+		return memberStatuses[status]
+	}
+	return fmt.Sprintf("unknown (%d)", status)
+}
+
+// memberVersion returns the Consul version of a member from the build tag, e.g. 1.12.0 from 1.12.0:09a8cdb4
+func memberVersion(member *api.AgentMember) string {
+	return strings.SplitN(member.Tags["build"], ":", 2)[0]
+}
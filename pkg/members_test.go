@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestQueryMembers(t *testing.T) {
+	srv, _, instance := sharedTestServer(t)
+
+	response := query(context.TODO(), instance, map[string]queryModel{
+		"lan":        {Format: "table", Type: "members"},
+		"wan":        {Format: "table", Type: "members", Pool: "wan"},
+		"timeseries": {Format: "timeseries", Type: "members"},
+		"invalid":    {Format: "table", Type: "members", Pool: "invalid"},
+		"datacenter": {Format: "table", Type: "members", Datacenter: "default"},
+		"all":        {Format: "table", Type: "members", Datacenter: "*"},
+		"namespace":  {Format: "table", Type: "members", Namespace: "*"},
+	})
+
+	for _, refID := range []string{"lan", "wan"} {
+		res := response.Responses[refID]
+		if res.Error != nil || len(res.Frames) != 1 || res.Frames[0].Rows() != 1 {
+			t.Fatalf("%s: expected one member, got error %v", refID, res.Error)
+		}
+		row := res.Frames[0].RowCopy(0)
+		if row[3] != "alive" || row[4] != "consul" || row[6] == "" {
+			t.Errorf("%s: expected an alive server with a version, got %v", refID, row)
+		}
+	}
+	if name := response.Responses["wan"].Frames[0].Fields[0].At(0); name != srv.Config.NodeName+".default" {
+		t.Errorf("wan: expected member %s.default, got %v", srv.Config.NodeName, name)
+	}
+
+	res := response.Responses["timeseries"]
+	if res.Error != nil || len(res.Frames) != len(memberStatuses) {
+		t.Fatalf("timeseries: expected a frame per status, got %d frames and error %v", len(res.Frames), res.Error)
+	}
+	for _, frame := range res.Frames {
+		expected := 0.0
+		if frame.Fields[1].Labels["status"] == "alive" {
+			expected = 1
+		}
+		if value := frame.Fields[1].At(0); value != expected {
+			t.Errorf("timeseries: expected %v members with status %s, got %v", expected, frame.Name, value)
+		}
+	}
+
+	if res := response.Responses["invalid"]; res.Error == nil {
+		t.Errorf("invalid: expected error for unknown pool")
+	}
+	for _, refID := range []string{"datacenter", "all", "namespace"} {
+		if res := response.Responses[refID]; res.Error == nil || len(res.Frames) != 0 {
+			t.Errorf("%s: expected error for members of another datacenter or namespace, got %d frames", refID, len(res.Frames))
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/hashicorp/consul/api"
+)
+
+// kvMetadataFields are the names of the metadata of a key, which can be added to get and table
+// responses and used as table columns with <key>@<name>
+var kvMetadataFields = []string{"createIndex", "modifyIndex", "lockIndex", "flags", "session"}
+
+func isKVMetadataField(name string) bool {
+	for _, field := range kvMetadataFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// kvMetadata returns the metadata name of kv. Indexes and flags are returned as int64,
+// the session as string. If kv is nil, nil is returned.
+func kvMetadata(kv *api.KVPair, name string) interface{} {
+	if kv == nil {
+		return nil
+	}
+	switch name {
+	case "createIndex":
+		return int64(kv.CreateIndex)
+	case "modifyIndex":
+		return int64(kv.ModifyIndex)
+	case "lockIndex":
+		return int64(kv.LockIndex)
+	case "flags":
+		return int64(kv.Flags)
+	case "session":
+		return kv.Session
+	}
+	return nil
+}
+
+// kvMetadataFrameFields returns a field per metadata of kvs, kvs[i] is the key of row i.
+// The fields are nullable, because keys of table rows can be missing.
+func kvMetadataFrameFields(kvs []*api.KVPair) []*data.Field {
+	var fields []*data.Field
+	for _, name := range kvMetadataFields {
+		fieldType := data.FieldTypeNullableInt64
+		if name == "session" {
+			fieldType = data.FieldTypeNullableString
+		}
+		field := data.NewFieldFromFieldType(fieldType, len(kvs))
+		field.Name = name
+		for i, kv := range kvs {
+			if value := kvMetadata(kv, name); value != nil {
+				field.SetConcrete(i, value)
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/hashicorp/consul/api"
+)
+
+func TestParseColumnsWithMetadata(t *testing.T) {
+	expected := []tableColumn{
+		{key: "../name"},
+		{key: "../config", metadata: "modifyIndex"},
+		{key: ".", metadata: "session"},
+		{key: "../user@example.com"},
+		{key: "../config", path: "ports"},
+	}
+	columns := parseColumns("../name,../config@modifyIndex,.@session,../user@example.com,../config#ports")
+	if !reflect.DeepEqual(columns, expected) {
+		t.Errorf("expected %+v, got %+v", expected, columns)
+	}
+	if name := columns[1].name(); name != "config@modifyIndex" {
+		t.Errorf("expected column name config@modifyIndex, got %s", name)
+	}
+}
+
+func TestQueryMetadata(t *testing.T) {
+	srv, consul := setupTestServer(t)
+	defer srv.Stop()
+
+	// lock deployments/web/name with a session
+	session, _, err := consul.Session().Create(&api.SessionEntry{Name: "lock"}, nil)
+	if err != nil {
+		t.Fatalf("could not create session: %v", err)
+	}
+	acquired, _, err := consul.KV().Acquire(&api.KVPair{Key: "deployments/web/name", Value: []byte("web"), Session: session}, nil)
+	if err != nil || !acquired {
+		t.Fatalf("could not acquire lock: %v", err)
+	}
+	kv, _, err := consul.KV().Get("deployments/web/name", nil)
+	if err != nil {
+		t.Fatalf("could not get key: %v", err)
+	}
+
+	instance, err := newInstanceSettings(consul, jsonData{})
+	if err != nil {
+		t.Fatalf("could not create instance: %v", err)
+	}
+
+	response := query(context.TODO(), instance, map[string]queryModel{
+		"get":   {Format: "timeseries", Type: "get", Target: "deployments/web/name", ValueFormat: "raw", Metadata: true},
+		"table": {Format: "table", Target: "deployments/*/name", Columns: "../name,.@modifyIndex,.@session", Metadata: true},
+	})
+
+	expectMetadata := func(t *testing.T, frame *data.Frame, row int) {
+		fields := map[string]*data.Field{}
+		for _, field := range frame.Fields {
+			fields[field.Name] = field
+		}
+		for name, expected := range map[string]interface{}{
+			"createIndex": int64(kv.CreateIndex),
+			"modifyIndex": int64(kv.ModifyIndex),
+			"lockIndex":   int64(1),
+			"flags":       int64(0),
+			"session":     session,
+		} {
+			field, ok := fields[name]
+			if !ok {
+				t.Errorf("expected field %s", name)
+				continue
+			}
+			if value, _ := field.ConcreteAt(row); value != expected {
+				t.Errorf("field %s: expected %v, got %v", name, expected, value)
+			}
+		}
+	}
+
+	t.Run("get", func(t *testing.T) {
+		res := response.Responses["get"]
+		if res.Error != nil || len(res.Frames) != 1 {
+			t.Fatalf("expected one frame, got %d frames and error %v", len(res.Frames), res.Error)
+		}
+		expectMetadata(t, res.Frames[0], 0)
+	})
+
+	t.Run("table", func(t *testing.T) {
+		res := response.Responses["table"]
+		if res.Error != nil || len(res.Frames) != 1 {
+			t.Fatalf("expected one frame, got %d frames and error %v", len(res.Frames), res.Error)
+		}
+		frame := res.Frames[0]
+		if frame.Rows() != 2 || frame.Fields[0].At(1) != "web" {
+			t.Fatalf("expected rows for api and web, got %v", frame.Fields)
+		}
+		expectMetadata(t, frame, 1)
+
+		if value, _ := frame.Fields[1].ConcreteAt(1); frame.Fields[1].Name != ".@modifyIndex" || value != int64(kv.ModifyIndex) {
+			t.Errorf("expected modifyIndex column, got %s %v", frame.Fields[1].Name, value)
+		}
+		if value, _ := frame.Fields[2].ConcreteAt(0); frame.Fields[2].Name != ".@session" || value != "" {
+			t.Errorf("expected empty session of the unlocked key, got %s %v", frame.Fields[2].Name, value)
+		}
+	})
+}
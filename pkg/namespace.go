@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// allNamespaces is the namespace of queries which are executed in every namespace.
+// Namespaces and partitions are available only in Consul Enterprise.
+const allNamespaces = "*"
+
+// queryAllNamespaces executes the query in every namespace of the datacenter and partition
+// of the query and labels the frames with their namespace.
+func queryAllNamespaces(ctx context.Context, instance *instanceSettings, query queryModel) backend.DataResponse {
+	log.DefaultLogger.Debug("queryAllNamespaces", "query", query)
+
+	opts := instance.queryOptions(query)
+	opts.Namespace = ""
+	namespaces, _, err := instance.consul.Namespaces().List(opts.WithContext(ctx))
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error consul namespaces: %v", err)}
+	}
+
+	var names []string
+	for _, namespace := range namespaces {
+		names = append(names, namespace.Name)
+	}
+
+	return fanOut("namespace", names, func(namespace string) backend.DataResponse {
+		nsQuery := query
+		nsQuery.Namespace = namespace
+		return runCachedQuery(ctx, instance, nsQuery)
+	})
+}
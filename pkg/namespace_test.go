@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestQueryOptionsNamespaceAndPartition(t *testing.T) {
+	instance, err := newInstanceSettings(nil, jsonData{Datacenter: "dc1", Namespace: "team-a", Partition: "web"})
+	if err != nil {
+		t.Fatalf("could not create instance: %v", err)
+	}
+
+	opts := instance.queryOptions(queryModel{})
+	if opts.Datacenter != "dc1" || opts.Namespace != "team-a" || opts.Partition != "web" {
+		t.Errorf("expected defaults of the instance, got %+v", opts)
+	}
+
+	opts = instance.queryOptions(queryModel{Datacenter: "dc2", Namespace: "team-b", Partition: "api"})
+	if opts.Datacenter != "dc2" || opts.Namespace != "team-b" || opts.Partition != "api" {
+		t.Errorf("expected overrides of the query, got %+v", opts)
+	}
+}
+
+func TestQueryAllNamespacesWithoutEnterprise(t *testing.T) {
+	srv, consul := setupTestServer(t)
+	defer srv.Stop()
+
+	instance, err := newInstanceSettings(consul, jsonData{})
+	if err != nil {
+		t.Fatalf("could not create instance: %v", err)
+	}
+	allNamespacesInstance, err := newInstanceSettings(consul, jsonData{Namespace: allNamespaces})
+	if err != nil {
+		t.Fatalf("could not create instance: %v", err)
+	}
+
+	// namespaces can only be listed with Consul Enterprise
+	response := query(context.TODO(), instance, map[string]queryModel{
+		"A": {Format: "timeseries", Type: "keys", Target: "registry/", Namespace: allNamespaces},
+	})
+	if response.Responses["A"].Error == nil {
+		t.Errorf("expected error when listing namespaces")
+	}
+
+	// the default namespace of the instance selects all namespaces as well
+	response = query(context.TODO(), allNamespacesInstance, map[string]queryModel{
+		"A": {Format: "timeseries", Type: "keys", Target: "registry/"},
+	})
+	if err := response.Responses["A"].Error; err == nil || !strings.Contains(err.Error(), "error consul namespaces") {
+		t.Errorf("expected error when listing namespaces for the default namespace, got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/hashicorp/consul/api"
+)
+
+// queryRaft returns the Raft peers of the datacenter.
+// Tables contain a row per server, time series the number of servers, voters and leaders.
+func queryRaft(ctx context.Context, consul *api.Client, query queryModel, opts *api.QueryOptions) backend.DataResponse {
+	log.DefaultLogger.Debug("queryRaft", "query", query)
+
+	configuration, err := consul.Operator().RaftGetConfiguration(opts.WithContext(ctx))
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error consul raft configuration: %v", err)}
+	}
+	servers := configuration.Servers
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Node < servers[j].Node
+	})
+
+	switch query.Format {
+	case "", "timeseries":
+		return generateDataResponseFromRaftServers(servers)
+	case "table":
+		return generateTableFromRaftServers(servers)
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown format %s", query.Format)}
+}
+
+// generateDataResponseFromRaftServers returns the number of servers, voters and leaders as series labeled with peers
+func generateDataResponseFromRaftServers(servers []*api.RaftServer) backend.DataResponse {
+	var voters, leaders float64
+	for _, server := range servers {
+		voters += boolValue(server.Voter)
+		leaders += boolValue(server.Leader)
+	}
+
+	now := time.Now()
+	return backend.DataResponse{Frames: []*data.Frame{
+		operatorFrame(now, "servers", data.Labels{"peers": "servers"}, float64(len(servers))),
+		operatorFrame(now, "voters", data.Labels{"peers": "voters"}, voters),
+		operatorFrame(now, "leaders", data.Labels{"peers": "leaders"}, leaders),
+	}}
+}
+
+func generateTableFromRaftServers(servers []*api.RaftServer) backend.DataResponse {
+	frame := data.NewFrame("raft",
+		data.NewField("id", nil, []string{}),
+		data.NewField("node", nil, []string{}),
+		data.NewField("address", nil, []string{}),
+		data.NewField("leader", nil, []bool{}),
+		data.NewField("voter", nil, []bool{}),
+		data.NewField("protocolVersion", nil, []string{}),
+	)
+	for _, server := range servers {
+		frame.AppendRow(server.ID, server.Node, server.Address, server.Leader, server.Voter, server.ProtocolVersion)
+	}
+	return backend.DataResponse{Frames: []*data.Frame{frame}}
+}
+
+// queryAutopilot returns the autopilot health of the servers of the datacenter.
+// Tables contain a row per server. Time series contain the healthy state and the failure tolerance of the
+// datacenter and the healthy state, last index and last contact in milliseconds of each server.
+func queryAutopilot(ctx context.Context, consul *api.Client, query queryModel, opts *api.QueryOptions) backend.DataResponse {
+	log.DefaultLogger.Debug("queryAutopilot", "query", query)
+
+	health, err := consul.Operator().AutopilotServerHealth(opts.WithContext(ctx))
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error consul autopilot health: %v", err)}
+	}
+	servers := health.Servers
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Name < servers[j].Name
+	})
+
+	switch query.Format {
+	case "", "timeseries":
+		return generateDataResponseFromAutopilotHealth(health)
+	case "table":
+		return generateTableFromAutopilotHealth(servers)
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown format %s", query.Format)}
+}
+
+func generateDataResponseFromAutopilotHealth(health *api.OperatorHealthReply) backend.DataResponse {
+	now := time.Now()
+	response := backend.DataResponse{Frames: []*data.Frame{
+		operatorFrame(now, "healthy", data.Labels{"metric": "healthy"}, boolValue(health.Healthy)),
+		operatorFrame(now, "failureTolerance", data.Labels{"metric": "failureTolerance"}, float64(health.FailureTolerance)),
+	}}
+	for _, server := range health.Servers {
+		for _, metric := range []struct {
+			name  string
+			value float64
+		}{
+			{"healthy", boolValue(server.Healthy)},
+			{"lastIndex", float64(server.LastIndex)},
+			{"lastContact", lastContactMilliseconds(server)},
+		} {
+			labels := data.Labels{"metric": metric.name, "id": server.ID, "name": server.Name}
+			response.Frames = append(response.Frames, operatorFrame(now, server.Name+" "+metric.name, labels, metric.value))
+		}
+	}
+	return response
+}
+
+func generateTableFromAutopilotHealth(servers []api.ServerHealth) backend.DataResponse {
+	frame := data.NewFrame("autopilot",
+		data.NewField("id", nil, []string{}),
+		data.NewField("name", nil, []string{}),
+		data.NewField("address", nil, []string{}),
+		data.NewField("serfStatus", nil, []string{}),
+		data.NewField("version", nil, []string{}),
+		data.NewField("leader", nil, []bool{}),
+		data.NewField("voter", nil, []bool{}),
+		data.NewField("healthy", nil, []bool{}),
+		data.NewField("lastTerm", nil, []int64{}),
+		data.NewField("lastIndex", nil, []int64{}),
+		data.NewField("lastContact", nil, []float64{}),
+		data.NewField("stableSince", nil, []time.Time{}),
+	)
+	frame.Fields[10].Config = &data.FieldConfig{Unit: "ms"}
+	for _, server := range servers {
+		frame.AppendRow(server.ID, server.Name, server.Address, server.SerfStatus, server.Version,
+			server.Leader, server.Voter, server.Healthy, int64(server.LastTerm), int64(server.LastIndex),
+			lastContactMilliseconds(server), server.StableSince)
+	}
+	return backend.DataResponse{Frames: []*data.Frame{frame}}
+}
+
+// lastContactMilliseconds returns the time since the last contact of the server with the leader in milliseconds
+func lastContactMilliseconds(server api.ServerHealth) float64 {
+	return float64(server.LastContact.Duration()) / float64(time.Millisecond)
+}
+
+func operatorFrame(now time.Time, name string, labels data.Labels, value float64) *data.Frame {
+	return data.NewFrame(name,
+		data.NewField("time", nil, []time.Time{now}),
+		data.NewField("values", labels, []float64{value}),
+	)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestQueryOperator(t *testing.T) {
+	srv, _, instance := sharedTestServer(t)
+
+	response := query(context.TODO(), instance, map[string]queryModel{
+		"raft":                {Format: "table", Type: "raft"},
+		"raftTimeseries":      {Format: "timeseries", Type: "raft"},
+		"autopilot":           {Format: "table", Type: "autopilot"},
+		"autopilotTimeseries": {Format: "timeseries", Type: "autopilot"},
+	})
+
+	t.Run("raft", func(t *testing.T) {
+		res := response.Responses["raft"]
+		if res.Error != nil || len(res.Frames) != 1 || res.Frames[0].Rows() != 1 {
+			t.Fatalf("expected one server, got error %v", res.Error)
+		}
+		row := res.Frames[0].RowCopy(0)
+		if row[1] != srv.Config.NodeName || row[3] != true || row[4] != true {
+			t.Errorf("expected the test server as leader and voter, got %v", row)
+		}
+	})
+
+	t.Run("raftTimeseries", func(t *testing.T) {
+		res := response.Responses["raftTimeseries"]
+		if res.Error != nil || len(res.Frames) != 3 {
+			t.Fatalf("expected three frames, got %d frames and error %v", len(res.Frames), res.Error)
+		}
+		for _, frame := range res.Frames {
+			if value := frame.Fields[1].At(0); value != 1.0 {
+				t.Errorf("expected one of %s, got %v", frame.Name, value)
+			}
+		}
+	})
+
+	t.Run("autopilot", func(t *testing.T) {
+		res := response.Responses["autopilot"]
+		if res.Error != nil || len(res.Frames) != 1 || res.Frames[0].Rows() != 1 {
+			t.Fatalf("expected one server, got error %v", res.Error)
+		}
+		row := res.Frames[0].RowCopy(0)
+		if row[1] != srv.Config.NodeName || row[5] != true || row[6] != true {
+			t.Errorf("expected the test server as leader and voter, got %v", row)
+		}
+	})
+
+	t.Run("autopilotTimeseries", func(t *testing.T) {
+		res := response.Responses["autopilotTimeseries"]
+		if res.Error != nil || len(res.Frames) != 5 {
+			t.Fatalf("expected five frames, got %d frames and error %v", len(res.Frames), res.Error)
+		}
+		if name := res.Frames[1].Name; name != "failureTolerance" {
+			t.Errorf("expected failure tolerance, got %s", name)
+		}
+		if labels := res.Frames[3].Fields[1].Labels; labels["name"] != srv.Config.NodeName || labels["metric"] != "lastIndex" {
+			t.Errorf("expected last index of the test server, got %v", labels)
+		}
+	})
+}
@@ -4,17 +4,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
-
+	"sync"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/datasource"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/hashicorp/consul/api"
 )
@@ -26,8 +29,10 @@ func newDatasource() datasource.ServeOpts {
 	}
 
 	return datasource.ServeOpts{
-		QueryDataHandler:   ds,
-		CheckHealthHandler: ds,
+		QueryDataHandler:    ds,
+		CheckHealthHandler:  ds,
+		StreamHandler:       ds,
+		CallResourceHandler: httpadapter.New(ds.newResourceHandler()),
 	}
 }
 
@@ -42,7 +47,7 @@ type ConsulDataSource struct {
 func (td *ConsulDataSource) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
 	log.DefaultLogger.Debug("QueryData", "request", req)
 
-	consul, err := td.getConsulClient(req.PluginContext)
+	instance, err := td.getInstance(req.PluginContext)
 	if err != nil {
 		return nil, err
 	}
@@ -56,10 +61,20 @@ func (td *ConsulDataSource) QueryData(ctx context.Context, req *backend.QueryDat
 		return nil, fmt.Errorf("no queries found in request")
 	}
 
-	return query(ctx, consul, queries), nil
+	response := query(ctx, instance, queries)
+	setStreamChannels(req.PluginContext, queries, response)
+	return response, nil
 }
 
 func (td *ConsulDataSource) getConsulClient(pluginCtx backend.PluginContext) (*api.Client, error) {
+	instance, err := td.getInstance(pluginCtx)
+	if err != nil {
+		return nil, err
+	}
+	return instance.consul, nil
+}
+
+func (td *ConsulDataSource) getInstance(pluginCtx backend.PluginContext) (*instanceSettings, error) {
 	instance, err := td.im.Get(pluginCtx)
 	if err != nil {
 		return nil, fmt.Errorf("could not get plugin instance: %v", err)
@@ -68,7 +83,7 @@ func (td *ConsulDataSource) getConsulClient(pluginCtx backend.PluginContext) (*a
 	if !ok {
 		return nil, fmt.Errorf("could not get plugin instance")
 	}
-	return instanceSettings.consul, nil
+	return instanceSettings, nil
 }
 
 type queryModel struct {
@@ -76,7 +91,45 @@ type queryModel struct {
 	Target  string `json:"target"`
 	Type    string `json:"type"`
 	Columns string `json:"columns"`
-	Error   error
+	Live    bool   `json:"live"`
+
+	Path        string `json:"path"`
+	ValueFormat string `json:"valueFormat"`
+
+	Datacenter string `json:"datacenter"`
+	Namespace  string `json:"namespace"`
+	Partition  string `json:"partition"`
+	Tag        string `json:"tag"`
+	NodeMeta   string `json:"nodeMeta"`
+
+	HealthFilter string `json:"healthFilter"`
+
+	// LockPrefix is the prefix of the keys searched for locks of sessions, locks are not searched if empty
+	LockPrefix string `json:"lockPrefix"`
+	// Pool is the gossip pool of agent members: lan (default) or wan
+	Pool string `json:"pool"`
+	// Kind is the kind of config entries, all supported kinds are queried if empty
+	Kind string `json:"kind"`
+	// ExpiresWithin is a duration like 720h, only ACL tokens expiring within it are returned if set
+	ExpiresWithin string `json:"expiresWithin"`
+
+	// Metadata adds the indexes, flags and session of the keys to get and table responses
+	Metadata bool `json:"metadata"`
+
+	Alerting      bool   `json:"alerting"`
+	SeriesFormat  string `json:"seriesFormat"`
+	ValueMappings string `json:"valueMappings"`
+
+	VariableSource string `json:"variableSource"`
+	Regex          string `json:"regex"`
+
+	ScopedVars map[string]scopedVar `json:"scopedVars"`
+
+	// History returns the recorded values of the target in TimeRange
+	History   bool              `json:"history"`
+	TimeRange backend.TimeRange `json:"-"`
+
+	Error error
 }
 
 func parseQueries(req *backend.QueryDataRequest) (map[string]queryModel, error) {
@@ -89,35 +142,130 @@ func parseQueries(req *backend.QueryDataRequest) (map[string]queryModel, error)
 			queries[rawQuery.RefID] = queryModel{Error: fmt.Errorf("error parsing query %s: %v", rawQuery.JSON, err)}
 			continue
 		}
+		q.TimeRange = rawQuery.TimeRange
 		queries[rawQuery.RefID] = q
 	}
 	return queries, nil
 }
 
-func query(ctx context.Context, consul *api.Client, queries map[string]queryModel) *backend.QueryDataResponse {
+func query(ctx context.Context, instance *instanceSettings, queries map[string]queryModel) *backend.QueryDataResponse {
 	log.DefaultLogger.Debug("query", "queries", queries)
 
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
 	response := backend.NewQueryDataResponse()
 	for refID, query := range queries {
-		if query.Error != nil {
-			response.Responses[refID] = backend.DataResponse{Error: query.Error}
-			continue
-		}
+		wg.Add(1)
+		go func(refID string, query queryModel) {
+			defer wg.Done()
 
-		switch query.Format {
-		case "", "timeseries":
-			response.Responses[refID] = queryTimeSeries(ctx, consul, query)
-		case "table":
-			response.Responses[refID] = queryTable(ctx, consul, query)
-		default:
-			response.Responses[refID] = backend.DataResponse{Error: fmt.Errorf("unknown format %s", query.Format)}
-		}
+			dataResponse := runQuery(ctx, instance, query)
+
+			mu.Lock()
+			response.Responses[refID] = dataResponse
+			mu.Unlock()
+		}(refID, query)
 	}
+	wg.Wait()
 
 	return response
 }
 
-func queryTimeSeries(ctx context.Context, consul *api.Client, query queryModel) backend.DataResponse {
+// runQuery executes a single query as soon as one of the query slots of the instance is free.
+// If ctx is cancelled before, the query is not sent to Consul. All requests of the query to Consul,
+// including the ones of its fan-outs, share one request limiter with the concurrency of the instance.
+func runQuery(ctx context.Context, instance *instanceSettings, query queryModel) backend.DataResponse {
+	if query.Error != nil {
+		return backend.DataResponse{Error: query.Error}
+	}
+
+	select {
+	case instance.querySlots <- struct{}{}:
+		defer func() { <-instance.querySlots }()
+	case <-ctx.Done():
+		return backend.DataResponse{Error: fmt.Errorf("query cancelled: %v", ctx.Err())}
+	}
+	if err := ctx.Err(); err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("query cancelled: %v", err)}
+	}
+
+	ctx = withRequestLimiter(ctx, newRequestLimiter(instance.concurrency))
+	return runTemplatedQuery(ctx, instance, query)
+}
+
+// runDatacenterQuery executes a query in a single datacenter. It is executed in every namespace if the
+// namespace of the query, or the default namespace of the instance if the query has none, is allNamespaces.
+func runDatacenterQuery(ctx context.Context, instance *instanceSettings, query queryModel) backend.DataResponse {
+	if instance.queryOptions(query).Namespace == allNamespaces {
+		return queryAllNamespaces(ctx, instance, query)
+	}
+	return runCachedQuery(ctx, instance, query)
+}
+
+// runCachedQuery executes a query in a single datacenter and namespace.
+// The response is cached if caching is enabled, except for history queries which depend on the time range.
+func runCachedQuery(ctx context.Context, instance *instanceSettings, query queryModel) backend.DataResponse {
+	consul := instance.consul
+	opts := instance.queryOptions(query)
+
+	if instance.cache == nil || query.History {
+		return executeQuery(ctx, instance, query, opts)
+	}
+	return instance.cache.cachedQuery(ctx, consul, query, opts, func() backend.DataResponse {
+		return executeQuery(ctx, instance, query, opts)
+	})
+}
+
+func executeQuery(ctx context.Context, instance *instanceSettings, query queryModel, opts *api.QueryOptions) backend.DataResponse {
+	consul := instance.consul
+
+	switch query.Type {
+	case "services", "nodes", "service":
+		return queryCatalog(ctx, consul, query, opts)
+	case "health":
+		return queryHealth(ctx, consul, query, opts)
+	case "variable":
+		return queryVariable(ctx, consul, query, opts)
+	case "sessions", "session":
+		return querySessions(ctx, consul, query, opts)
+	case "members":
+		return queryMembers(consul, query)
+	case "raft":
+		return queryRaft(ctx, consul, query, opts)
+	case "autopilot":
+		return queryAutopilot(ctx, consul, query, opts)
+	case "intentions":
+		return queryIntentions(ctx, consul, query, opts)
+	case "topology":
+		return queryTopology(ctx, consul, query, instance.concurrency, opts)
+	case "caroots":
+		return queryCARoots(ctx, consul, query, opts)
+	case "configentries":
+		return queryConfigEntries(ctx, consul, query, opts)
+	case "preparedqueries", "preparedquery":
+		return queryPreparedQueries(ctx, consul, query, opts)
+	case "acltokens", "aclpolicies", "aclroles", "aclauthmethods":
+		return queryACL(ctx, consul, query, opts)
+	}
+
+	switch query.Format {
+	case "", "timeseries":
+		if query.History {
+			return queryHistory(instance.history, query, opts)
+		}
+		if query.Alerting {
+			return queryAlerting(ctx, consul, query, instance.concurrency, opts)
+		}
+		return queryTimeSeries(ctx, consul, query, instance.concurrency, opts)
+	case "table":
+		return queryTable(ctx, consul, query, instance.concurrency, opts)
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown format %s", query.Format)}
+}
+
+func queryTimeSeries(ctx context.Context, consul *api.Client, query queryModel, concurrency int, opts *api.QueryOptions) backend.DataResponse {
 	log.DefaultLogger.Debug("queryTimeSeries", "query", query)
 
 	if query.Format == "" {
@@ -134,26 +282,26 @@ func queryTimeSeries(ctx context.Context, consul *api.Client, query queryModel)
 
 	switch query.Type {
 	case "get":
-		return handleGet(ctx, consul, q)
+		return handleGet(ctx, consul, q, query.ValueFormat, query.Path, query.Metadata, opts)
 	case "keys":
-		return handleKeys(ctx, consul, q)
+		return handleKeys(ctx, consul, q, opts)
 	case "tags":
-		return handleTags(ctx, consul, q, false)
+		return handleTags(ctx, consul, q, false, concurrency, opts)
 	case "tagsrec":
-		return handleTags(ctx, consul, q, true)
+		return handleTags(ctx, consul, q, true, concurrency, opts)
 	}
 	return backend.DataResponse{Error: fmt.Errorf("unknown query type: %s", query.Type)}
 }
 
-func handleGet(ctx context.Context, consul *api.Client, target string) backend.DataResponse {
-	log.DefaultLogger.Debug("handleGet", "target", target)
+func handleGet(ctx context.Context, consul *api.Client, target, valueFormat, valuePath string, metadata bool, opts *api.QueryOptions) backend.DataResponse {
+	log.DefaultLogger.Debug("handleGet", "target", target, "format", valueFormat, "path", valuePath)
 
 	if strings.HasSuffix(target, "/") {
 		target = target[:len(target)-1]
 	}
 
 	var kvs []*api.KVPair
-	kv, _, err := consul.KV().Get(target, (&api.QueryOptions{RequireConsistent: true}).WithContext(ctx))
+	kv, _, err := consul.KV().Get(target, opts.WithContext(ctx))
 	if err != nil {
 		return backend.DataResponse{Error: fmt.Errorf("error consul get %s: %v", target, err)}
 	}
@@ -161,24 +309,34 @@ func handleGet(ctx context.Context, consul *api.Client, target string) backend.D
 		kvs = append(kvs, kv)
 	}
 
-	return generateDataResponseFromKV(kvs)
+	response := generateDataResponseFromKV(kvs, valueFormat, valuePath)
+	if metadata && response.Error == nil {
+		for i, frame := range response.Frames {
+			rowKVs := make([]*api.KVPair, frame.Rows())
+			for row := range rowKVs {
+				rowKVs[row] = kvs[i]
+			}
+			frame.Fields = append(frame.Fields, kvMetadataFrameFields(rowKVs)...)
+		}
+	}
+	return response
 }
 
-func handleKeys(ctx context.Context, consul *api.Client, target string) backend.DataResponse {
+func handleKeys(ctx context.Context, consul *api.Client, target string, opts *api.QueryOptions) backend.DataResponse {
 	log.DefaultLogger.Debug("handleKeys", "target", target)
 
 	if !strings.HasSuffix(target, "/") {
 		target = target + "/"
 	}
 
-	keys, _, err := consul.KV().Keys(target, "/", (&api.QueryOptions{RequireConsistent: true}).WithContext(ctx))
+	keys, _, err := consul.KV().Keys(target, "/", opts.WithContext(ctx))
 	if err != nil {
 		return backend.DataResponse{Error: fmt.Errorf("error consul keys %s: %v", target, err)}
 	}
 	return generateDataResponseFromKeys(keys)
 }
 
-func handleTags(ctx context.Context, consul *api.Client, target string, recursive bool) backend.DataResponse {
+func handleTags(ctx context.Context, consul *api.Client, target string, recursive bool, concurrency int, opts *api.QueryOptions) backend.DataResponse {
 	log.DefaultLogger.Debug("handleTags", "target", target)
 
 	if !strings.HasSuffix(target, "/") {
@@ -189,30 +347,40 @@ func handleTags(ctx context.Context, consul *api.Client, target string, recursiv
 		separator = ""
 	}
 
-	keys, _, err := consul.KV().Keys(target, separator, (&api.QueryOptions{RequireConsistent: true}).WithContext(ctx))
+	keys, _, err := consul.KV().Keys(target, separator, opts.WithContext(ctx))
 	if err != nil {
 		return backend.DataResponse{Error: fmt.Errorf("error consul keys %s: %v", target, err)}
 	}
 
+	kvs, err := fetchKVs(ctx, consul, keys, recursive, concurrency, opts)
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error consul get %s: %v", target, err)}
+	}
+
 	var tagKVs []*api.KVPair
 	for _, key := range keys {
-		tagKV, _, err := consul.KV().Get(key, (&api.QueryOptions{RequireConsistent: true}).WithContext(ctx))
-		if err != nil {
-			return backend.DataResponse{Error: fmt.Errorf("error consul get %s: %v", key, err)}
-		}
-		if tagKV != nil {
+		if tagKV, ok := kvs[key]; ok {
 			tagKVs = append(tagKVs, tagKV)
 		}
 	}
 	return generateDataResponseWithTags(target, tagKVs)
 }
 
-func generateDataResponseFromKV(kvs []*api.KVPair) backend.DataResponse {
-	log.DefaultLogger.Debug("generateDataResponseFromKV", "kv", kvs)
+func generateDataResponseFromKV(kvs []*api.KVPair, valueFormat, valuePath string) backend.DataResponse {
+	log.DefaultLogger.Debug("generateDataResponseFromKV", "kv", kvs, "format", valueFormat, "path", valuePath)
 
 	response := backend.DataResponse{}
 
 	for _, kv := range kvs {
+		if valueFormat != "" || valuePath != "" {
+			frame, err := generateFrameFromDecodedValue(kv, valueFormat, valuePath)
+			if err != nil {
+				return backend.DataResponse{Error: fmt.Errorf("error extracting values from %s: %v", kv.Key, err)}
+			}
+			response.Frames = append(response.Frames, frame)
+			continue
+		}
+
 		floatValue, err := strconv.ParseFloat(string(kv.Value), 64)
 		if err != nil {
 			return backend.DataResponse{Error: err}
@@ -229,6 +397,26 @@ func generateDataResponseFromKV(kvs []*api.KVPair) backend.DataResponse {
 	return response
 }
 
+// generateFrameFromDecodedValue generates a frame from the values at valuePath in the value of kv
+// decoded with valueFormat. Arrays result in one row per element.
+func generateFrameFromDecodedValue(kv *api.KVPair, valueFormat, valuePath string) (*data.Frame, error) {
+	values, err := extractValues(kv.Value, valueFormat, valuePath)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	times := make([]time.Time, len(values))
+	for i := range times {
+		times[i] = now
+	}
+	log.DefaultLogger.Debug("appending data frame to response", "name", kv.Key, "time", now, "value", values)
+	return data.NewFrame(kv.Key,
+		data.NewField("time", nil, times),
+		newFieldFromValues("values", nil, values),
+	), nil
+}
+
 func generateDataResponseFromKeys(keys []string) backend.DataResponse {
 	log.DefaultLogger.Debug("generateDataResponseFromKeys", "keys", keys)
 
@@ -268,7 +456,7 @@ func generateDataResponseWithTags(target string, tagKVs []*api.KVPair) backend.D
 	return response
 }
 
-func queryTable(ctx context.Context, consul *api.Client, query queryModel) backend.DataResponse {
+func queryTable(ctx context.Context, consul *api.Client, query queryModel, concurrency int, opts *api.QueryOptions) backend.DataResponse {
 	log.DefaultLogger.Debug("queryTable", "query", query)
 	defer func() {
 		if err := recover(); err != nil {
@@ -292,7 +480,7 @@ func queryTable(ctx context.Context, consul *api.Client, query queryModel) backe
 
 	// Get keys with prefix
 	log.DefaultLogger.Debug("queryTable: get keys below prefix", "prefix", prefix)
-	keys, _, err := consul.KV().Keys(prefix, "", &api.QueryOptions{})
+	keys, _, err := consul.KV().Keys(prefix, "", opts.WithContext(ctx))
 	if err != nil {
 		return backend.DataResponse{Error: fmt.Errorf("error gettings keys %s from consul: %v", prefix, err)}
 	}
@@ -306,49 +494,132 @@ func queryTable(ctx context.Context, consul *api.Client, query queryModel) backe
 		}
 	}
 
-	columns := strings.Split(query.Columns, ",")
-
-	fields := []*data.Field{}
-	for rowIdx, key := range matchingKeys {
-		for colIdx, col := range columns {
+	columns := parseColumns(query.Columns)
 
-			// calculate key for column value
-			colKey := calculateColumnKey(key, col)
+	// calculate keys for all column values and get them from Consul
+	var colKeys []string
+	for _, key := range matchingKeys {
+		for _, col := range columns {
+			colKeys = append(colKeys, calculateColumnKey(key, col.key))
+		}
+		// the metadata fields contain the metadata of the matching key
+		if query.Metadata {
+			colKeys = append(colKeys, key)
+		}
+	}
+	kvs, err := fetchKVs(ctx, consul, colKeys, true, concurrency, opts)
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error getting column values from consul: %v", err)}
+	}
 
-			// get field from Consul
-			field, value := getColumnValueForKey(ctx, consul, colKey)
+	// One matchingKey results in multiple rows if a column value is an array
+	var rows [][]interface{}
+	var rowKVs []*api.KVPair
+	for _, key := range matchingKeys {
+		cells := make([][]interface{}, len(columns))
+		rowCount := 1
+		for colIdx, col := range columns {
+			colKey := calculateColumnKey(key, col.key)
+			if col.metadata != "" {
+				cells[colIdx] = []interface{}{kvMetadata(kvs[colKey], col.metadata)}
+			} else {
+				cells[colIdx] = getColumnValues(colKey, kvs[colKey], query.ValueFormat, col.path)
+			}
+			if len(cells[colIdx]) > rowCount {
+				rowCount = len(cells[colIdx])
+			}
+		}
 
-			// If it's the first row ,append it to the fields array
-			if rowIdx == 0 {
-				log.DefaultLogger.Debug("queryTable: appending first row field", "value", value, "rowIdx", rowIdx, "colIdx", colIdx)
-				fields = append(fields, field)
-				continue
+		for i := 0; i < rowCount; i++ {
+			row := make([]interface{}, len(columns))
+			for colIdx := range columns {
+				switch {
+				// single values are repeated in all rows of the key
+				case len(cells[colIdx]) == 1:
+					row[colIdx] = cells[colIdx][0]
+				case i < len(cells[colIdx]):
+					row[colIdx] = cells[colIdx][i]
+				}
 			}
+			log.DefaultLogger.Debug("queryTable: appending row", "key", key, "row", row)
+			rows = append(rows, row)
+			rowKVs = append(rowKVs, kvs[key])
+		}
+	}
 
-			// Else, append it to the field of the current column
-			log.DefaultLogger.Debug("queryTable: appending value to field", "value", value, "rowIdx", rowIdx, "colIdx", colIdx)
-			fields[colIdx].Append(value)
+	fields := []*data.Field{}
+	for colIdx, col := range columns {
+		values := make([]interface{}, len(rows))
+		for rowIdx, row := range rows {
+			values[rowIdx] = row[colIdx]
 		}
+		fields = append(fields, newFieldFromValues(col.name(), nil, values))
+	}
+	if query.Metadata {
+		fields = append(fields, kvMetadataFrameFields(rowKVs)...)
 	}
 
 	return backend.DataResponse{Frames: []*data.Frame{data.NewFrame("table", fields...)}}
 }
 
-func getColumnValueForKey(ctx context.Context, consul *api.Client, colKey string) (*data.Field, interface{}) {
-	log.DefaultLogger.Debug("getColumnValueForKey", "key", colKey)
+// tableColumn is a column of a table query. Columns have the format <key>[#<path>] or <key>@<metadata>,
+// e.g. ../spec/replicas, ../config#spec.replicas or ../config@modifyIndex
+type tableColumn struct {
+	key      string
+	path     string
+	metadata string
+}
+
+func parseColumns(columns string) []tableColumn {
+	var tableColumns []tableColumn
+	for _, col := range strings.Split(columns, ",") {
+		parts := strings.SplitN(col, "#", 2)
+		column := tableColumn{key: parts[0]}
+		if len(parts) == 2 {
+			column.path = parts[1]
+		} else if idx := strings.LastIndex(column.key, "@"); idx >= 0 && isKVMetadataField(column.key[idx+1:]) {
+			column.key, column.metadata = column.key[:idx], column.key[idx+1:]
+		}
+		tableColumns = append(tableColumns, column)
+	}
+	return tableColumns
+}
+
+func (c tableColumn) name() string {
+	if c.path != "" {
+		return path.Base(c.key) + "#" + c.path
+	}
+	if c.metadata != "" {
+		return path.Base(c.key) + "@" + c.metadata
+	}
+	return path.Base(c.key)
+}
 
-	kv, _, err := consul.KV().Get(colKey, (&api.QueryOptions{}).WithContext(ctx))
-	if err != nil || kv == nil {
-		return data.NewField(path.Base(colKey), nil, []string{"Not Found"}), "Not Found"
+// getColumnValues returns the values of a table cell. Without valueFormat and valuePath
+// this is the value of kv, otherwise the values extracted from the decoded value.
+func getColumnValues(colKey string, kv *api.KVPair, valueFormat, valuePath string) []interface{} {
+	log.DefaultLogger.Debug("getColumnValues", "key", colKey, "format", valueFormat, "path", valuePath)
+
+	if kv == nil {
+		return []interface{}{"Not Found"}
+	}
+
+	if valueFormat != "" || valuePath != "" {
+		values, err := extractValues(kv.Value, valueFormat, valuePath)
+		if err != nil {
+			log.DefaultLogger.Debug("getColumnValues: could not extract value", "key", colKey, "path", valuePath, "err", err)
+			return []interface{}{nil}
+		}
+		return values
 	}
 
 	// try to parse int
 	intValue, err := strconv.ParseInt(string(kv.Value), 10, 64)
 	if err != nil {
-		return data.NewField(path.Base(colKey), nil, []string{string(kv.Value)}), string(kv.Value)
+		return []interface{}{string(kv.Value)}
 	}
 
-	return data.NewField(path.Base(colKey), nil, []int64{intValue}), intValue
+	return []interface{}{intValue}
 }
 
 func calculateColumnKey(key string, col string) string {
@@ -369,7 +640,10 @@ func (td *ConsulDataSource) CheckHealth(ctx context.Context, req *backend.CheckH
 
 	consul, err := td.getConsulClient(req.PluginContext)
 	if err != nil {
-		return nil, err
+		return &backend.CheckHealthResult{
+			Status:  backend.HealthStatusError,
+			Message: err.Error(),
+		}, nil
 	}
 
 	if _, err := consul.Status().Leader(); err != nil {
@@ -385,12 +659,58 @@ func (td *ConsulDataSource) CheckHealth(ctx context.Context, req *backend.CheckH
 	}, nil
 }
 
+// defaultMaxConcurrentQueries is the default number of queries executed in parallel per datasource
+const defaultMaxConcurrentQueries = 5
+
 type instanceSettings struct {
-	consul *api.Client
+	consul      *api.Client
+	concurrency int
+	consistency string
+	datacenter  string
+	namespace   string
+	partition   string
+
+	// querySlots limits the number of queries executed in parallel
+	querySlots chan struct{}
+
+	// cache is nil if caching is disabled
+	cache *responseCache
+
+	// history is nil if the history recorder is disabled
+	history *historyRecorder
 }
 
 type jsonData struct {
-	ConsulAddr string
+	ConsulAddr           string
+	Datacenter           string
+	Namespace            string
+	Partition            string
+	Concurrency          int
+	MaxConcurrentQueries int
+
+	// CacheTTL is the duration responses are cached, e.g. 30s. Caching is disabled if empty.
+	CacheTTL string
+	// Consistency is the Consul consistency mode: default, stale or consistent (default)
+	Consistency string
+
+	TLSAuth           bool
+	TLSAuthWithCACert bool
+	TLSSkipVerify     bool
+	ServerName        string
+
+	// HistoryKeys is a comma-separated list of keys and prefixes ending with / whose values are recorded.
+	// The history recorder is disabled if empty.
+	HistoryKeys string
+	// HistoryPath is the path of the database of the history recorder
+	HistoryPath string
+	// HistoryRetention is the duration recorded values are kept, e.g. 720h (default: 168h)
+	HistoryRetention string
+
+	// SnapshotPath is a snapshot saved with consul snapshot save, a JSON file exported with consul kv export
+	// or a directory of those files. KV queries are served from it in memory instead of ConsulAddr if set.
+	SnapshotPath string
+	// SnapshotEncoding is the encoding of the values of JSON exports: base64 (default) or raw
+	SnapshotEncoding string
 }
 
 func newDataSourceInstance(setting backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
@@ -400,24 +720,131 @@ func newDataSourceInstance(setting backend.DataSourceInstanceSettings) (instance
 		return nil, fmt.Errorf("error decoding jsonData: %v", err)
 	}
 
-	if jData.ConsulAddr == "" {
-		log.DefaultLogger.Error("newDataSourceInstance", "ConsulAddr", jData.ConsulAddr, "err", "consulAddr should not be empty")
-		return nil, fmt.Errorf("consulAddr should not be empty")
+	var client *api.Client
+	if jData.SnapshotPath != "" {
+		var err error
+		client, err = newSnapshotClient(jData.SnapshotPath, jData.SnapshotEncoding)
+		if err != nil {
+			return nil, fmt.Errorf("error loading snapshot: %v", err)
+		}
+	} else {
+		if jData.ConsulAddr == "" {
+			log.DefaultLogger.Error("newDataSourceInstance", "ConsulAddr", jData.ConsulAddr, "err", "consulAddr should not be empty")
+			return nil, fmt.Errorf("consulAddr should not be empty")
+		}
+
+		conf := api.DefaultConfig()
+		conf.Address = jData.ConsulAddr
+		conf.Token = setting.DecryptedSecureJSONData["consulToken"]
+
+		if err := setTLSConfig(&conf.TLSConfig, jData, setting.DecryptedSecureJSONData); err != nil {
+			return nil, fmt.Errorf("invalid TLS settings: %v", err)
+		}
+
+		var err error
+		client, err = newConsulClient(conf)
+		if err != nil {
+			return nil, fmt.Errorf("error creating consul client: %v", err)
+		}
+	}
+
+	if jData.HistoryPath == "" {
+		jData.HistoryPath = filepath.Join(os.TempDir(), fmt.Sprintf("grafana-consul-datasource-%s.db", setting.UID))
 	}
+	return newInstanceSettings(client, jData)
+}
 
-	conf := api.DefaultConfig()
-	conf.Address = jData.ConsulAddr
-	conf.Token = setting.DecryptedSecureJSONData["consulToken"]
-	conf.TLSConfig.InsecureSkipVerify = true
+func newInstanceSettings(client *api.Client, jData jsonData) (*instanceSettings, error) {
+	concurrency := jData.Concurrency
+	if concurrency < 1 {
+		concurrency = defaultConcurrency
+	}
+	maxConcurrentQueries := jData.MaxConcurrentQueries
+	if maxConcurrentQueries < 1 {
+		maxConcurrentQueries = defaultMaxConcurrentQueries
+	}
 
-	client, err := api.NewClient(conf)
-	if err != nil {
-		return nil, fmt.Errorf("error creating consul client: %v", err)
+	consistency := jData.Consistency
+	switch consistency {
+	case "":
+		consistency = "consistent"
+	case "default", "stale", "consistent":
+	default:
+		return nil, fmt.Errorf("unknown consistency mode %s", consistency)
 	}
-	return &instanceSettings{
-		consul: client,
-	}, nil
+
+	var cache *responseCache
+	if jData.CacheTTL != "" {
+		ttl, err := time.ParseDuration(jData.CacheTTL)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing cache ttl %s: %v", jData.CacheTTL, err)
+		}
+		if ttl > 0 {
+			cache = newResponseCache(ttl)
+		}
+	}
+
+	instance := &instanceSettings{
+		consul:      client,
+		concurrency: concurrency,
+		consistency: consistency,
+		datacenter:  jData.Datacenter,
+		namespace:   jData.Namespace,
+		partition:   jData.Partition,
+		querySlots:  make(chan struct{}, maxConcurrentQueries),
+		cache:       cache,
+	}
+
+	if keys := parseHistoryKeys(jData.HistoryKeys); len(keys) > 0 {
+		retention := defaultHistoryRetention
+		if jData.HistoryRetention != "" {
+			var err error
+			retention, err = time.ParseDuration(jData.HistoryRetention)
+			if err != nil || retention <= 0 {
+				return nil, fmt.Errorf("invalid history retention %s", jData.HistoryRetention)
+			}
+		}
+		history, err := newHistoryRecorder(client, instance.queryOptions(queryModel{}), jData.HistoryPath, keys, retention)
+		if err != nil {
+			return nil, err
+		}
+		history.start()
+		instance.history = history
+	}
+	return instance, nil
+}
+
+// queryOptions returns the query options with the consistency mode of the instance and the datacenter,
+// namespace and partition of the query. If they are not set in the query, the defaults of the instance are used.
+func (s *instanceSettings) queryOptions(query queryModel) *api.QueryOptions {
+	opts := &api.QueryOptions{
+		Datacenter: firstNonEmpty(query.Datacenter, s.datacenter),
+		Namespace:  firstNonEmpty(query.Namespace, s.namespace),
+		Partition:  firstNonEmpty(query.Partition, s.partition),
+	}
+	switch s.consistency {
+	case "stale":
+		opts.AllowStale = true
+	case "consistent":
+		opts.RequireConsistent = true
+	}
+	return opts
 }
 
 func (s *instanceSettings) Dispose() {
+	if s.cache != nil {
+		s.cache.clear()
+	}
+	if s.history != nil {
+		s.history.stop()
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
 }
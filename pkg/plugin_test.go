@@ -10,8 +10,11 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/consul/sdk/testutil"
 	"github.com/sergi/go-diff/diffmatchpatch"
@@ -144,38 +147,373 @@ func TestQuery(t *testing.T) {
 			},
 			golden: "table.json",
 		},
+		{
+			name: "timeseries get with path",
+			queries: map[string]queryModel{
+				"abc": {
+					Format: "timeseries",
+					Type:   "get",
+					Target: "deployments/web/config",
+					Path:   "replicas",
+				},
+			},
+			golden: "timeseries-get-path.json",
+		},
+		{
+			name: "timeseries get with path not found",
+			queries: map[string]queryModel{
+				"abc": {
+					Format: "timeseries",
+					Type:   "get",
+					Target: "deployments/web/config",
+					Path:   "spec.replicas",
+				},
+			},
+			golden: "timeseries-get-path-not-found.json",
+		},
+		{
+			name: "timeseries get yaml with path",
+			queries: map[string]queryModel{
+				"abc": {
+					Format:      "timeseries",
+					Type:        "get",
+					Target:      "deployments/web/values.yaml",
+					ValueFormat: "yaml",
+					Path:        "resources.limits.cpu",
+				},
+			},
+			golden: "timeseries-get-yaml.json",
+		},
+		{
+			name: "timeseries get with unknown value format",
+			queries: map[string]queryModel{
+				"abc": {
+					Format:      "timeseries",
+					Type:        "get",
+					Target:      "deployments/web/values.yaml",
+					ValueFormat: "xml",
+				},
+			},
+			golden: "timeseries-get-unknown-format.json",
+		},
+		{
+			name: "table with paths",
+			queries: map[string]queryModel{
+				"xyz": {
+					Format:  "table",
+					Target:  "deployments/*/name",
+					Columns: "../name,../config#replicas,../config#enabled,../config#ports",
+				},
+			},
+			golden: "table-paths.json",
+		},
+		{
+			name: "catalog services",
+			queries: map[string]queryModel{
+				"abc": {
+					Type: "services",
+				},
+			},
+			golden: "catalog-services.json",
+		},
+		{
+			name: "catalog nodes",
+			queries: map[string]queryModel{
+				"abc": {
+					Type: "nodes",
+				},
+			},
+			golden: "catalog-nodes.json",
+		},
+		{
+			name: "catalog service",
+			queries: map[string]queryModel{
+				"abc": {
+					Type:   "service",
+					Target: "consul",
+				},
+			},
+			golden: "catalog-service.json",
+		},
+		{
+			name: "catalog service without name",
+			queries: map[string]queryModel{
+				"abc": {
+					Type: "service",
+				},
+			},
+			golden: "catalog-service-empty.json",
+		},
+		{
+			name: "catalog nodes with invalid node meta",
+			queries: map[string]queryModel{
+				"abc": {
+					Type:     "nodes",
+					NodeMeta: "invalid",
+				},
+			},
+			golden: "catalog-nodes-invalid-meta.json",
+		},
+		{
+			name: "health table",
+			queries: map[string]queryModel{
+				"abc": {
+					Format: "table",
+					Type:   "health",
+				},
+			},
+			golden: "health-table.json",
+		},
+		{
+			name: "health check without target",
+			queries: map[string]queryModel{
+				"abc": {
+					Format:       "timeseries",
+					Type:         "health",
+					HealthFilter: "check",
+				},
+			},
+			golden: "health-no-target.json",
+		},
+		{
+			name: "members",
+			queries: map[string]queryModel{
+				"table":      {Format: "table", Type: "members"},
+				"timeseries": {Format: "timeseries", Type: "members"},
+			},
+			golden: "members.json",
+		},
+		{
+			name: "raft",
+			queries: map[string]queryModel{
+				"table":      {Format: "table", Type: "raft"},
+				"timeseries": {Format: "timeseries", Type: "raft"},
+			},
+			golden: "raft.json",
+		},
+		{
+			name: "autopilot table",
+			queries: map[string]queryModel{
+				"abc": {Format: "table", Type: "autopilot"},
+			},
+			golden: "autopilot-table.json",
+		},
+		{
+			name: "sessions table",
+			queries: map[string]queryModel{
+				"abc": {Format: "table", Type: "sessions", LockPrefix: "locks/"},
+			},
+			golden: "sessions-table.json",
+		},
+		{
+			name: "intentions",
+			queries: map[string]queryModel{
+				"table":      {Format: "table", Type: "intentions"},
+				"timeseries": {Format: "timeseries", Type: "intentions", Target: "web"},
+				"nodegraph":  {Format: "nodegraph", Type: "intentions"},
+			},
+			golden: "intentions.json",
+		},
+		{
+			name: "topology",
+			queries: map[string]queryModel{
+				"table":      {Format: "table", Type: "topology"},
+				"timeseries": {Format: "timeseries", Type: "topology"},
+				"nodegraph":  {Format: "nodegraph", Type: "topology"},
+			},
+			golden: "topology.json",
+		},
+		{
+			name: "caroots table",
+			queries: map[string]queryModel{
+				"abc": {Format: "table", Type: "caroots"},
+			},
+			golden: "caroots-table.json",
+		},
+		{
+			name: "configentries",
+			queries: map[string]queryModel{
+				"table":      {Format: "table", Type: "configentries"},
+				"timeseries": {Format: "timeseries", Type: "configentries", Kind: api.ServiceSplitter},
+			},
+			golden: "configentries.json",
+		},
+		{
+			name: "preparedqueries",
+			queries: map[string]queryModel{
+				"list":       {Format: "table", Type: "preparedqueries"},
+				"execute":    {Format: "table", Type: "preparedquery", Target: "search-nearest"},
+				"timeseries": {Format: "timeseries", Type: "preparedquery", Target: "search-nearest"},
+			},
+			golden: "preparedqueries.json",
+		},
 	}
 
-	srv, consul := setupTestServer(t)
-	defer srv.Stop()
+	_, _, instance := sharedTestServer(t)
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			response := query(context.TODO(), consul, tt.queries)
+			response := query(context.TODO(), instance, tt.queries)
+			checkGolden(t, response, tt.golden)
+		})
+	}
+}
 
-			text, _ := json.MarshalIndent(response, "", "  ")
+// checkGolden compares the frames and fields of the response with the golden file. Set writeGolden to update
+// the golden file.
+func checkGolden(t *testing.T, response *backend.QueryDataResponse, goldenName string) {
+	text, _ := json.MarshalIndent(newGoldenResponse(response), "", "  ")
 
-			goldenFile := path.Join("testdata/golden", tt.golden)
-			writeGolden := false
-			if writeGolden {
-				ioutil.WriteFile(path.Join(goldenFile), text, os.ModePerm)
-			}
+	goldenFile := path.Join("testdata/golden", goldenName)
+	writeGolden := false
+	if writeGolden {
+		ioutil.WriteFile(path.Join(goldenFile), text, os.ModePerm)
+	}
+
+	// values are not printed, because they contain the current time
+	golden, err := ioutil.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatalf("could not read golden file %s: %v", goldenFile, err)
+	}
+
+	dmp := diffmatchpatch.New()
+
+	diffs := dmp.DiffMain(string(golden), string(text), false)
+
+	if !(len(diffs) == 1 && diffs[0].Type == diffmatchpatch.DiffEqual) {
+		t.Errorf("result was not as expected\n")
+		t.Logf("diff to golden %s:\n%s", goldenName, diffPrettyText(diffs))
+	}
+}
+
+// goldenResponse mirrors the structure of a backend.QueryDataResponse without
+// the field values, because they contain timestamps and change on every run.
+type goldenResponse struct {
+	Responses map[string]goldenDataResponse
+}
+
+type goldenDataResponse struct {
+	Frames []goldenFrame
+	Error  interface{}
+}
+
+type goldenFrame struct {
+	Name   string
+	Fields []goldenField
+	RefID  string
+	Meta   *data.FrameMeta
+}
 
-			// errors and values are not printed, because they are unexported fields
-			golden, err := ioutil.ReadFile(goldenFile)
-			if err != nil {
-				t.Fatalf("could not read golden file %s: %v", goldenFile, err)
+type goldenField struct {
+	Name   string
+	Labels data.Labels
+	Config *data.FieldConfig
+}
+
+func newGoldenResponse(response *backend.QueryDataResponse) goldenResponse {
+	golden := goldenResponse{Responses: map[string]goldenDataResponse{}}
+	for refID, res := range response.Responses {
+		goldenRes := goldenDataResponse{}
+		if res.Error != nil {
+			goldenRes.Error = res.Error.Error()
+		}
+		for _, frame := range res.Frames {
+			goldenFrame := goldenFrame{Name: frame.Name, RefID: frame.RefID, Meta: frame.Meta}
+			for _, field := range frame.Fields {
+				goldenFrame.Fields = append(goldenFrame.Fields, goldenField{Name: field.Name, Labels: field.Labels, Config: field.Config})
 			}
+			goldenRes.Frames = append(goldenRes.Frames, goldenFrame)
+		}
+		golden.Responses[refID] = goldenRes
+	}
+	return golden
+}
 
-			dmp := diffmatchpatch.New()
+func TestQueryTableWithPaths(t *testing.T) {
+	srv, consul := setupTestServer(t)
+	defer srv.Stop()
 
-			diffs := dmp.DiffMain(string(golden), string(text), false)
+	response := queryTable(context.TODO(), consul, queryModel{
+		Format:  "table",
+		Target:  "deployments/*/name",
+		Columns: "../name,../config#replicas,../config#enabled,../config#ports,../config#missing,../values.yaml#image.tag",
+	}, defaultConcurrency, &api.QueryOptions{})
+	if response.Error != nil {
+		t.Fatalf("unexpected error: %v", response.Error)
+	}
 
-			if !(len(diffs) == 1 && diffs[0].Type == diffmatchpatch.DiffEqual) {
-				t.Errorf("result for query %+v was not as expected\n", tt.queries)
-				t.Logf("diff to golden %s:\n%s", tt.golden, diffPrettyText(diffs))
+	// the ports of web are exploded into two rows
+	expected := [][]interface{}{
+		{"api", float64(2), false, float64(8080), nil, "2.0"},
+		{"web", float64(3), true, float64(80), nil, "1.19"},
+		{"web", float64(3), true, float64(443), nil, "1.19"},
+	}
+	frame := response.Frames[0]
+	if rowLen, _ := frame.RowLen(); rowLen != len(expected) {
+		t.Fatalf("expected %d rows, got %d", len(expected), rowLen)
+	}
+	for rowIdx, row := range expected {
+		for colIdx, value := range row {
+			actual, ok := frame.ConcreteAt(colIdx, rowIdx)
+			if !ok {
+				actual = nil
 			}
-		})
+			if actual != value {
+				t.Errorf("row %d column %s: expected %v, got %v", rowIdx, frame.Fields[colIdx].Name, value, actual)
+			}
+		}
+	}
+}
+
+func TestQueryParallel(t *testing.T) {
+	srv, consul := setupTestServer(t)
+	defer srv.Stop()
+
+	queries := map[string]queryModel{
+		"A": {Format: "timeseries", Type: "get", Target: "registry/apiregistration.k8s.io/apiservices/v1.apps/spec/groupPriorityMinimum"},
+		"B": {Format: "timeseries", Type: "keys", Target: "registry/apiregistration.k8s.io/apiservices/"},
+		"C": {Format: "timeseries", Type: "unknown", Target: "registry/"},
+		"D": {Format: "table", Target: "deployments/*/name", Columns: "../name"},
+		"E": {Error: fmt.Errorf("invalid query")},
+	}
+	instance, err := newInstanceSettings(consul, jsonData{MaxConcurrentQueries: 2})
+	if err != nil {
+		t.Fatalf("could not create instance: %v", err)
+	}
+
+	response := query(context.TODO(), instance, queries)
+	if len(response.Responses) != len(queries) {
+		t.Fatalf("expected %d responses, got %d", len(queries), len(response.Responses))
+	}
+	for refID := range queries {
+		expectError := refID == "C" || refID == "E"
+		if err := response.Responses[refID].Error; (err != nil) != expectError {
+			t.Errorf("query %s: expected error %v, got %v", refID, expectError, err)
+		}
+	}
+}
+
+func TestQueryCancelled(t *testing.T) {
+	srv, consul := setupTestServer(t)
+	defer srv.Stop()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	queries := map[string]queryModel{
+		"A": {Format: "timeseries", Type: "get", Target: "registry/apiregistration.k8s.io/apiservices/v1.apps/spec/groupPriorityMinimum"},
+		"B": {Format: "table", Target: "deployments/*/name", Columns: "../name"},
+	}
+	instance, err := newInstanceSettings(consul, jsonData{})
+	if err != nil {
+		t.Fatalf("could not create instance: %v", err)
+	}
+
+	response := query(ctx, instance, queries)
+	for refID := range queries {
+		if response.Responses[refID].Error == nil {
+			t.Errorf("query %s: expected error for cancelled context", refID)
+		}
 	}
 }
 
@@ -212,12 +550,69 @@ func diffPrettyText(diffs []diffmatchpatch.Diff) string {
 	return buff.String()
 }
 
-func setupTestServer(t *testing.T) (*testutil.TestServer, *api.Client) {
+// shared is the test server of the tests which only read, see sharedTestServer
+var shared struct {
+	once     sync.Once
+	srv      *testutil.TestServer
+	instance *instanceSettings
+	fixtures testFixtures
+}
+
+// testFixtures are the entries created on the shared test server in addition to the example data
+type testFixtures struct {
+	leaderSession string
+	idleSession   string
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if shared.srv != nil {
+		shared.srv.Stop()
+	}
+	os.Exit(code)
+}
+
+// sharedTestServer returns a test server with the example data and the sessions, services, intentions,
+// config entries and prepared queries of the query type tests. It is started by the first test and stopped
+// after all tests, so tests must not change its data. It uses free ports, tests with their own server on
+// port 8500 run next to it.
+func sharedTestServer(t *testing.T) (*testutil.TestServer, testFixtures, *instanceSettings) {
+	shared.once.Do(func() {
+		srv, consul := startTestServer(t, nil)
+		// stopped by TestMain, even if creating the fixtures fails
+		shared.srv = srv
+
+		fixtures := testFixtures{}
+		fixtures.leaderSession, fixtures.idleSession = createTestSessions(t, consul)
+		registerTestConnectServices(t, srv, consul)
+		setTestConfigEntries(t, consul)
+		createTestPreparedQuery(t, consul)
+
+		instance, err := newInstanceSettings(consul, jsonData{})
+		if err != nil {
+			t.Fatalf("could not create instance: %v", err)
+		}
+		shared.fixtures, shared.instance = fixtures, instance
+	})
+	if shared.instance == nil {
+		t.Fatalf("shared test server is not available")
+	}
+	return shared.srv, shared.fixtures, shared.instance
+}
+
+func setupTestServer(t testing.TB) (*testutil.TestServer, *api.Client) {
+	return startTestServer(t, &testutil.TestPortConfig{
+		HTTP: 8500,
+	})
+}
+
+// startTestServer starts a test server with the example data. Without ports free ports are used.
+func startTestServer(t testing.TB, ports *testutil.TestPortConfig) (*testutil.TestServer, *api.Client) {
 	srv, err := testutil.NewTestServerConfigT(&testing.T{}, func(c *testutil.TestServerConfig) {
 		//c.Stdout = ioutil.Discard
 		//c.Stderr = ioutil.Discard
-		c.Ports = &testutil.TestPortConfig{
-			HTTP: 8500,
+		if ports != nil {
+			c.Ports = ports
 		}
 
 		c.Datacenter = "default"
@@ -279,7 +674,7 @@ func newConsul(consulAddr, consulToken string) (*api.Client, error) {
 	conf.Token = consulToken
 	conf.TLSConfig.InsecureSkipVerify = true
 
-	client, err := api.NewClient(conf)
+	client, err := newConsulClient(conf)
 	if err != nil {
 		return nil, fmt.Errorf("error creating consul client: %v", err)
 	}
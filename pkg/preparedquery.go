@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/hashicorp/consul/api"
+)
+
+// queryPreparedQueries lists the prepared queries (type preparedqueries) or executes the prepared query
+// with the target name or ID (type preparedquery).
+func queryPreparedQueries(ctx context.Context, consul *api.Client, query queryModel, opts *api.QueryOptions) backend.DataResponse {
+	log.DefaultLogger.Debug("queryPreparedQueries", "query", query)
+
+	opts = opts.WithContext(ctx)
+	if query.Type == "preparedquery" {
+		return executePreparedQuery(consul, query, opts)
+	}
+
+	definitions, _, err := consul.PreparedQuery().List(opts)
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error consul prepared queries: %v", err)}
+	}
+	sort.Slice(definitions, func(i, j int) bool {
+		if definitions[i].Name != definitions[j].Name {
+			return definitions[i].Name < definitions[j].Name
+		}
+		return definitions[i].ID < definitions[j].ID
+	})
+
+	switch query.Format {
+	case "", "timeseries":
+		return generateDataResponseFromPreparedQueries(definitions)
+	case "table":
+		return generateTableFromPreparedQueries(definitions)
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown format %s", query.Format)}
+}
+
+// generateDataResponseFromPreparedQueries returns a series per service with the number of prepared queries
+func generateDataResponseFromPreparedQueries(definitions []*api.PreparedQueryDefinition) backend.DataResponse {
+	counts := map[string]float64{}
+	var services []string
+	for _, definition := range definitions {
+		if _, ok := counts[definition.Service.Service]; !ok {
+			services = append(services, definition.Service.Service)
+		}
+		counts[definition.Service.Service]++
+	}
+	sort.Strings(services)
+
+	response := backend.DataResponse{}
+	now := time.Now()
+	for _, service := range services {
+		response.Frames = append(response.Frames, data.NewFrame(service,
+			data.NewField("time", nil, []time.Time{now}),
+			data.NewField("values", data.Labels{"service": service}, []float64{counts[service]}),
+		))
+	}
+	return response
+}
+
+func generateTableFromPreparedQueries(definitions []*api.PreparedQueryDefinition) backend.DataResponse {
+	frame := data.NewFrame("preparedqueries",
+		data.NewField("id", nil, []string{}),
+		data.NewField("name", nil, []string{}),
+		data.NewField("service", nil, []string{}),
+		data.NewField("namespace", nil, []string{}),
+		data.NewField("tags", nil, []string{}),
+		data.NewField("onlyPassing", nil, []bool{}),
+		data.NewField("near", nil, []string{}),
+		data.NewField("failoverNearestN", nil, []int64{}),
+		data.NewField("failoverDatacenters", nil, []string{}),
+		data.NewField("template", nil, []string{}),
+		data.NewField("dnsTTL", nil, []string{}),
+	)
+	for _, definition := range definitions {
+		service := definition.Service
+		frame.AppendRow(definition.ID, definition.Name, service.Service, service.Namespace, strings.Join(service.Tags, ","),
+			service.OnlyPassing, service.Near, int64(service.Failover.NearestN), strings.Join(service.Failover.Datacenters, ","),
+			definition.Template.Type, definition.DNS.TTL)
+	}
+	return backend.DataResponse{Frames: []*data.Frame{frame}}
+}
+
+// executePreparedQuery executes the prepared query with the target name or ID and returns the healthy instances.
+// The datacenter of the instances is the datacenter which served the query, failovers is the number of
+// datacenters which were tried before.
+func executePreparedQuery(consul *api.Client, query queryModel, opts *api.QueryOptions) backend.DataResponse {
+	if query.Target == "" {
+		return backend.DataResponse{Error: fmt.Errorf("prepared query name or ID should not be empty")}
+	}
+
+	result, _, err := consul.PreparedQuery().Execute(query.Target, opts)
+	if err != nil {
+		return backend.DataResponse{Error: fmt.Errorf("error consul execute prepared query %s: %v", query.Target, err)}
+	}
+
+	switch query.Format {
+	case "", "timeseries":
+		now := time.Now()
+		series := func(metric string, value int) *data.Frame {
+			labels := data.Labels{"metric": metric, "query": query.Target, "service": result.Service, "datacenter": result.Datacenter}
+			return data.NewFrame(metric,
+				data.NewField("time", nil, []time.Time{now}),
+				data.NewField("values", labels, []float64{float64(value)}),
+			)
+		}
+		return backend.DataResponse{Frames: []*data.Frame{series("instances", len(result.Nodes)), series("failovers", result.Failovers)}}
+	case "table":
+		frame := data.NewFrame(result.Service,
+			data.NewField("node", nil, []string{}),
+			data.NewField("address", nil, []string{}),
+			data.NewField("datacenter", nil, []string{}),
+			data.NewField("failovers", nil, []int64{}),
+			data.NewField("serviceID", nil, []string{}),
+			data.NewField("serviceAddress", nil, []string{}),
+			data.NewField("servicePort", nil, []int64{}),
+			data.NewField("serviceTags", nil, []string{}),
+			data.NewField("serviceMeta", nil, []string{}),
+			data.NewField("status", nil, []string{}),
+		)
+		for _, entry := range result.Nodes {
+			frame.AppendRow(entry.Node.Node, entry.Node.Address, result.Datacenter, int64(result.Failovers),
+				entry.Service.ID, entry.Service.Address, int64(entry.Service.Port), joinSorted(entry.Service.Tags),
+				joinMap(entry.Service.Meta), entry.Checks.AggregatedStatus())
+		}
+		return backend.DataResponse{Frames: []*data.Frame{frame}}
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown format %s", query.Format)}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// createTestPreparedQuery registers search-1 and creates the prepared query search-nearest for it
+func createTestPreparedQuery(t *testing.T, consul *api.Client) {
+	if err := consul.Agent().ServiceRegister(&api.AgentServiceRegistration{ID: "search-1", Name: "search", Port: 9200, Tags: []string{"v1"}}); err != nil {
+		t.Fatalf("could not register service: %v", err)
+	}
+	_, _, err := consul.PreparedQuery().Create(&api.PreparedQueryDefinition{
+		Name: "search-nearest",
+		Service: api.ServiceQuery{
+			Service:     "search",
+			OnlyPassing: true,
+			Failover:    api.QueryDatacenterOptions{Datacenters: []string{"dc2", "dc3"}},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("could not create prepared query: %v", err)
+	}
+}
+
+func TestQueryPreparedQueries(t *testing.T) {
+	srv, _, instance := sharedTestServer(t)
+
+	response := query(context.TODO(), instance, map[string]queryModel{
+		"list":       {Format: "table", Type: "preparedqueries"},
+		"execute":    {Format: "table", Type: "preparedquery", Target: "search-nearest"},
+		"timeseries": {Format: "timeseries", Type: "preparedquery", Target: "search-nearest"},
+		"empty":      {Format: "table", Type: "preparedquery"},
+	})
+
+	t.Run("list", func(t *testing.T) {
+		res := response.Responses["list"]
+		if res.Error != nil || len(res.Frames) != 1 || res.Frames[0].Rows() != 1 {
+			t.Fatalf("expected one prepared query, got error %v", res.Error)
+		}
+		row := res.Frames[0].RowCopy(0)
+		if row[1] != "search-nearest" || row[2] != "search" || row[5] != true || row[8] != "dc2,dc3" {
+			t.Errorf("expected the search-nearest query with failover datacenters, got %v", row)
+		}
+	})
+
+	t.Run("execute", func(t *testing.T) {
+		res := response.Responses["execute"]
+		if res.Error != nil || len(res.Frames) != 1 || res.Frames[0].Rows() != 1 {
+			t.Fatalf("expected one instance, got error %v", res.Error)
+		}
+		row := res.Frames[0].RowCopy(0)
+		if row[0] != srv.Config.NodeName || row[2] != "default" || row[3] != int64(0) || row[4] != "search-1" || row[7] != "v1" || row[9] != api.HealthPassing {
+			t.Errorf("expected the passing search-1 instance served by the default datacenter, got %v", row)
+		}
+	})
+
+	t.Run("timeseries", func(t *testing.T) {
+		res := response.Responses["timeseries"]
+		if res.Error != nil || len(res.Frames) != 2 {
+			t.Fatalf("expected instances and failovers, got %d frames and error %v", len(res.Frames), res.Error)
+		}
+		if values := res.Frames[0].Fields[1]; values.At(0) != 1.0 || values.Labels["datacenter"] != "default" {
+			t.Errorf("expected one instance in the default datacenter, got %v with labels %v", values.At(0), values.Labels)
+		}
+		if values := res.Frames[1].Fields[1]; values.At(0) != 0.0 {
+			t.Errorf("expected no failovers, got %v", values.At(0))
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if res := response.Responses["empty"]; res.Error == nil {
+			t.Errorf("expected error without prepared query")
+		}
+	})
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
+	"github.com/hashicorp/consul/api"
+)
+
+const (
+	// defaultResourceLimit is the default number of items returned by the list resources
+	defaultResourceLimit = 100
+	// maxResourceLimit is the maximum number of items returned by the list resources
+	maxResourceLimit = 1000
+	// maxResourceValueSize is the maximum number of bytes of a value returned by the value resource
+	maxResourceValueSize = 64 * 1024
+)
+
+// listResponse is a page of a list resource. Next is the cursor to get the next page
+// with the after parameter, it is empty on the last page.
+type listResponse struct {
+	Items []string `json:"items"`
+	Next  string   `json:"next,omitempty"`
+}
+
+type valueResponse struct {
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	Size      int    `json:"size"`
+	Truncated bool   `json:"truncated"`
+}
+
+// newResourceHandler returns the handler of the resources the query editor uses to browse Consul:
+// /keys?prefix=&separator=, /services, /nodes, /datacenters and /value?key=.
+// The list resources are sorted and paginated with the limit and after parameters. Consul has no pagination,
+// so the full list is fetched for every page. To bound it, /keys with an empty separator lists all keys below
+// the prefix recursively only if the prefix is not empty.
+// All resources accept the datacenter, namespace and partition parameters.
+func (td *ConsulDataSource) newResourceHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys", td.handleKeysResource)
+	mux.HandleFunc("/services", td.handleServicesResource)
+	mux.HandleFunc("/nodes", td.handleNodesResource)
+	mux.HandleFunc("/datacenters", td.handleDatacentersResource)
+	mux.HandleFunc("/value", td.handleValueResource)
+	return mux
+}
+
+func (td *ConsulDataSource) handleKeysResource(rw http.ResponseWriter, req *http.Request) {
+	consul, opts, ok := td.resourceClient(rw, req)
+	if !ok {
+		return
+	}
+
+	prefix := req.URL.Query().Get("prefix")
+	separator := "/"
+	if values, ok := req.URL.Query()["separator"]; ok {
+		separator = values[0]
+	}
+	if separator == "" && prefix == "" {
+		writeResourceError(rw, http.StatusBadRequest, fmt.Errorf("keys without separator need a prefix, they would list the whole key value store"))
+		return
+	}
+	keys, _, err := consul.KV().Keys(prefix, separator, opts)
+	if err != nil {
+		writeResourceError(rw, http.StatusBadGateway, fmt.Errorf("error consul keys: %v", err))
+		return
+	}
+	writeResourceList(rw, req, keys)
+}
+
+func (td *ConsulDataSource) handleServicesResource(rw http.ResponseWriter, req *http.Request) {
+	consul, opts, ok := td.resourceClient(rw, req)
+	if !ok {
+		return
+	}
+
+	services, _, err := consul.Catalog().Services(opts)
+	if err != nil {
+		writeResourceError(rw, http.StatusBadGateway, fmt.Errorf("error consul catalog services: %v", err))
+		return
+	}
+	var names []string
+	for name := range services {
+		names = append(names, name)
+	}
+	writeResourceList(rw, req, names)
+}
+
+func (td *ConsulDataSource) handleNodesResource(rw http.ResponseWriter, req *http.Request) {
+	consul, opts, ok := td.resourceClient(rw, req)
+	if !ok {
+		return
+	}
+
+	nodes, _, err := consul.Catalog().Nodes(opts)
+	if err != nil {
+		writeResourceError(rw, http.StatusBadGateway, fmt.Errorf("error consul catalog nodes: %v", err))
+		return
+	}
+	var names []string
+	for _, node := range nodes {
+		names = append(names, node.Node)
+	}
+	writeResourceList(rw, req, names)
+}
+
+func (td *ConsulDataSource) handleDatacentersResource(rw http.ResponseWriter, req *http.Request) {
+	consul, _, ok := td.resourceClient(rw, req)
+	if !ok {
+		return
+	}
+
+	datacenters, err := consul.Catalog().Datacenters()
+	if err != nil {
+		writeResourceError(rw, http.StatusBadGateway, fmt.Errorf("error consul catalog datacenters: %v", err))
+		return
+	}
+	writeResourceList(rw, req, datacenters)
+}
+
+func (td *ConsulDataSource) handleValueResource(rw http.ResponseWriter, req *http.Request) {
+	consul, opts, ok := td.resourceClient(rw, req)
+	if !ok {
+		return
+	}
+
+	key := req.URL.Query().Get("key")
+	if key == "" {
+		writeResourceError(rw, http.StatusBadRequest, fmt.Errorf("key should not be empty"))
+		return
+	}
+	kv, _, err := consul.KV().Get(key, opts)
+	if err != nil {
+		writeResourceError(rw, http.StatusBadGateway, fmt.Errorf("error consul get %s: %v", key, err))
+		return
+	}
+	if kv == nil {
+		writeResourceError(rw, http.StatusNotFound, fmt.Errorf("key %s not found", key))
+		return
+	}
+
+	response := valueResponse{Key: kv.Key, Value: string(kv.Value), Size: len(kv.Value)}
+	if len(kv.Value) > maxResourceValueSize {
+		response.Value = string(truncateValue(kv.Value, maxResourceValueSize))
+		response.Truncated = true
+	}
+	writeResourceJSON(rw, response)
+}
+
+// truncateValue returns the first size bytes of value. A UTF-8 character cut in the middle is removed, so
+// it is not replaced by an invalid character when the value is encoded as JSON string.
+func truncateValue(value []byte, size int) []byte {
+	// a cut character starts at most utf8.UTFMax-1 bytes before the end, binary values are cut at size
+	for end := size; end >= 0 && end > size-utf8.UTFMax; end-- {
+		if utf8.RuneStart(value[end]) {
+			return value[:end]
+		}
+	}
+	return value[:size]
+}
+
+// resourceClient returns the Consul client of the datasource and the query options with the
+// datacenter, namespace and partition parameters of the request.
+func (td *ConsulDataSource) resourceClient(rw http.ResponseWriter, req *http.Request) (*api.Client, *api.QueryOptions, bool) {
+	log.DefaultLogger.Debug("CallResource", "url", req.URL.String())
+
+	if req.Method != http.MethodGet {
+		writeResourceError(rw, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", req.Method))
+		return nil, nil, false
+	}
+
+	instance, err := td.getInstance(httpadapter.PluginConfigFromContext(req.Context()))
+	if err != nil {
+		writeResourceError(rw, http.StatusInternalServerError, err)
+		return nil, nil, false
+	}
+
+	params := req.URL.Query()
+	opts := instance.queryOptions(queryModel{
+		Datacenter: params.Get("datacenter"),
+		Namespace:  params.Get("namespace"),
+		Partition:  params.Get("partition"),
+	})
+	return instance.consul, opts.WithContext(req.Context()), true
+}
+
+// writeResourceList writes the page of the sorted items after the after parameter
+// with at most limit items. If the prefix parameter is set, only items with the prefix are returned.
+func writeResourceList(rw http.ResponseWriter, req *http.Request, items []string) {
+	limit := defaultResourceLimit
+	if param := req.URL.Query().Get("limit"); param != "" {
+		var err error
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit < 1 {
+			writeResourceError(rw, http.StatusBadRequest, fmt.Errorf("invalid limit %s", param))
+			return
+		}
+	}
+	if limit > maxResourceLimit {
+		limit = maxResourceLimit
+	}
+
+	if prefix := req.URL.Query().Get("prefix"); prefix != "" {
+		var matchingItems []string
+		for _, item := range items {
+			if strings.HasPrefix(item, prefix) {
+				matchingItems = append(matchingItems, item)
+			}
+		}
+		items = matchingItems
+	}
+
+	sort.Strings(items)
+	start := 0
+	if after := req.URL.Query().Get("after"); after != "" {
+		start = sort.Search(len(items), func(i int) bool { return items[i] > after })
+	}
+
+	response := listResponse{Items: []string{}}
+	end := start + limit
+	if end < len(items) {
+		response.Next = items[end-1]
+	} else {
+		end = len(items)
+	}
+	response.Items = append(response.Items, items[start:end]...)
+	writeResourceJSON(rw, response)
+}
+
+func writeResourceJSON(rw http.ResponseWriter, response interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(response); err != nil {
+		log.DefaultLogger.Error("could not write resource response", "err", err)
+	}
+}
+
+func writeResourceError(rw http.ResponseWriter, status int, err error) {
+	log.DefaultLogger.Debug("CallResource failed", "status", status, "err", err)
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(map[string]string{"error": err.Error()}); err != nil {
+		log.DefaultLogger.Error("could not write resource response", "err", err)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/datasource"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
+	"github.com/hashicorp/consul/api"
+)
+
+type resourceSender struct {
+	status int
+	body   []byte
+}
+
+func (s *resourceSender) Send(resp *backend.CallResourceResponse) error {
+	if resp.Status != 0 {
+		s.status = resp.Status
+	}
+	s.body = append(s.body, resp.Body...)
+	return nil
+}
+
+func TestCallResource(t *testing.T) {
+	srv, consul := setupTestServer(t)
+	defer srv.Stop()
+
+	if _, err := consul.KV().Put(&api.KVPair{Key: "large/value", Value: []byte(strings.Repeat("x", maxResourceValueSize+1))}, nil); err != nil {
+		t.Fatalf("could not put large value: %v", err)
+	}
+	// the last character starts one byte before the limit
+	if _, err := consul.KV().Put(&api.KVPair{Key: "large/text", Value: []byte(strings.Repeat("x", maxResourceValueSize-1) + "€")}, nil); err != nil {
+		t.Fatalf("could not put large value: %v", err)
+	}
+
+	ds := &ConsulDataSource{
+		im: datasource.NewInstanceManager(newDataSourceInstance),
+	}
+	handler := httpadapter.New(ds.newResourceHandler())
+	pluginCtx := backend.PluginContext{
+		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+			JSONData: []byte(`{"consulAddr":"http://` + srv.HTTPAddr + `"}`),
+		},
+	}
+
+	call := func(t *testing.T, path, query string, response interface{}) int {
+		sender := &resourceSender{}
+		err := handler.CallResource(context.TODO(), &backend.CallResourceRequest{
+			PluginContext: pluginCtx,
+			Method:        http.MethodGet,
+			Path:          path,
+			URL:           path + "?" + query,
+		}, sender)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if sender.status == http.StatusOK {
+			if err := json.Unmarshal(sender.body, response); err != nil {
+				t.Fatalf("could not unmarshal response %s: %v", sender.body, err)
+			}
+		}
+		return sender.status
+	}
+
+	t.Run("keys paginated", func(t *testing.T) {
+		var items []string
+		after := ""
+		for pages := 0; ; pages++ {
+			var page listResponse
+			if status := call(t, "keys", "prefix=registry/apiregistration.k8s.io/apiservices/&limit=10&after="+after, &page); status != http.StatusOK {
+				t.Fatalf("unexpected status %d", status)
+			}
+			if len(page.Items) > 10 {
+				t.Fatalf("expected at most 10 items, got %d", len(page.Items))
+			}
+			items = append(items, page.Items...)
+			if page.Next == "" {
+				break
+			}
+			after = page.Next
+		}
+		if len(items) != 25 || items[0] != "registry/apiregistration.k8s.io/apiservices/v1./" {
+			t.Errorf("expected 25 subkeys, got %d: %v", len(items), items)
+		}
+	})
+
+	t.Run("keys recursive", func(t *testing.T) {
+		var page listResponse
+		if status := call(t, "keys", "prefix=deployments/web/&separator=", &page); status != http.StatusOK || !containsAll(page.Items, []string{"deployments/web/name"}) {
+			t.Errorf("expected the keys below deployments/web/, got %d %v", status, page.Items)
+		}
+		if status := call(t, "keys", "separator=", nil); status != http.StatusBadRequest {
+			t.Errorf("expected status %d for the whole key value store, got %d", http.StatusBadRequest, status)
+		}
+	})
+
+	t.Run("services", func(t *testing.T) {
+		var page listResponse
+		if status := call(t, "services", "prefix=con", &page); status != http.StatusOK || len(page.Items) != 1 || page.Items[0] != "consul" {
+			t.Errorf("expected service consul, got %d %v", status, page.Items)
+		}
+	})
+
+	t.Run("datacenters", func(t *testing.T) {
+		var page listResponse
+		if status := call(t, "datacenters", "", &page); status != http.StatusOK || len(page.Items) != 1 || page.Items[0] != "default" {
+			t.Errorf("expected datacenter default, got %d %v", status, page.Items)
+		}
+	})
+
+	t.Run("nodes", func(t *testing.T) {
+		var page listResponse
+		if status := call(t, "nodes", "", &page); status != http.StatusOK || len(page.Items) != 1 {
+			t.Errorf("expected one node, got %d %v", status, page.Items)
+		}
+	})
+
+	t.Run("value", func(t *testing.T) {
+		var value valueResponse
+		if status := call(t, "value", "key=deployments/web/name", &value); status != http.StatusOK || value.Value != "web" || value.Truncated {
+			t.Errorf("expected value web, got %d %+v", status, value)
+		}
+	})
+
+	t.Run("value truncated", func(t *testing.T) {
+		var value valueResponse
+		if status := call(t, "value", "key=large/value", &value); status != http.StatusOK || !value.Truncated || len(value.Value) != maxResourceValueSize || value.Size != maxResourceValueSize+1 {
+			t.Errorf("expected truncated value, got %d truncated=%v size=%d", status, value.Truncated, value.Size)
+		}
+	})
+
+	t.Run("value truncated before a multi-byte character", func(t *testing.T) {
+		var value valueResponse
+		if status := call(t, "value", "key=large/text", &value); status != http.StatusOK || !value.Truncated || value.Value != strings.Repeat("x", maxResourceValueSize-1) || value.Size != maxResourceValueSize+2 {
+			t.Errorf("expected value truncated before the last character, got %d truncated=%v size=%d length=%d", status, value.Truncated, value.Size, len(value.Value))
+		}
+	})
+
+	t.Run("value not found", func(t *testing.T) {
+		if status := call(t, "value", "key=missing", nil); status != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, status)
+		}
+	})
+
+	t.Run("invalid limit", func(t *testing.T) {
+		if status := call(t, "keys", "limit=0", nil); status != http.StatusBadRequest {
+			t.Errorf("expected status %d, got %d", http.StatusBadRequest, status)
+		}
+	})
+}
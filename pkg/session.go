@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/hashicorp/consul/api"
+)
+
+// querySessions returns the sessions of all nodes, of the target node (type sessions) or the
+// session with the target ID (type session) together with the keys they lock.
+// Locked keys are searched below the lock prefix of the query, locks are not searched without a lock prefix
+// because this would read the whole key value store.
+func querySessions(ctx context.Context, consul *api.Client, query queryModel, opts *api.QueryOptions) backend.DataResponse {
+	log.DefaultLogger.Debug("querySessions", "query", query)
+
+	opts = opts.WithContext(ctx)
+	sessions, err := getSessions(consul, query.Type, query.Target, opts)
+	if err != nil {
+		return backend.DataResponse{Error: err}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].Node != sessions[j].Node {
+			return sessions[i].Node < sessions[j].Node
+		}
+		return sessions[i].ID < sessions[j].ID
+	})
+
+	locks := map[string][]*api.KVPair{}
+	if query.LockPrefix != "" {
+		locks, err = getLocks(consul, query.LockPrefix, opts)
+		if err != nil {
+			return backend.DataResponse{Error: err}
+		}
+	}
+
+	switch query.Format {
+	case "", "timeseries":
+		return generateDataResponseFromSessions(sessions, locks)
+	case "table":
+		return generateTableFromSessions(sessions, locks)
+	}
+	return backend.DataResponse{Error: fmt.Errorf("unknown format %s", query.Format)}
+}
+
+func getSessions(consul *api.Client, queryType, target string, opts *api.QueryOptions) ([]*api.SessionEntry, error) {
+	switch {
+	case queryType == "session":
+		if target == "" {
+			return nil, fmt.Errorf("session ID should not be empty")
+		}
+		session, _, err := consul.Session().Info(target, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error consul session info %s: %v", target, err)
+		}
+		if session == nil {
+			return nil, nil
+		}
+		return []*api.SessionEntry{session}, nil
+	case target != "":
+		sessions, _, err := consul.Session().Node(target, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error consul sessions of node %s: %v", target, err)
+		}
+		return sessions, nil
+	}
+	sessions, _, err := consul.Session().List(opts)
+	if err != nil {
+		return nil, fmt.Errorf("error consul sessions: %v", err)
+	}
+	return sessions, nil
+}
+
+// getLocks returns the keys below prefix which are locked by a session, grouped by session ID
+func getLocks(consul *api.Client, prefix string, opts *api.QueryOptions) (map[string][]*api.KVPair, error) {
+	kvs, _, err := consul.KV().List(prefix, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error consul list %s: %v", prefix, err)
+	}
+
+	locks := map[string][]*api.KVPair{}
+	for _, kv := range kvs {
+		if kv.Session != "" {
+			locks[kv.Session] = append(locks[kv.Session], kv)
+		}
+	}
+	return locks, nil
+}
+
+// generateDataResponseFromSessions returns a series per session with the number of keys it locks
+func generateDataResponseFromSessions(sessions []*api.SessionEntry, locks map[string][]*api.KVPair) backend.DataResponse {
+	response := backend.DataResponse{}
+
+	now := time.Now()
+	for _, session := range sessions {
+		labels := data.Labels{
+			"id":   session.ID,
+			"name": session.Name,
+			"node": session.Node,
+		}
+		response.Frames = append(response.Frames, data.NewFrame(session.ID,
+			data.NewField("time", nil, []time.Time{now}),
+			data.NewField("values", labels, []float64{float64(len(locks[session.ID]))}),
+		))
+	}
+	return response
+}
+
+// generateTableFromSessions returns a row per session and locked key. Sessions without locks have a row with an empty key.
+func generateTableFromSessions(sessions []*api.SessionEntry, locks map[string][]*api.KVPair) backend.DataResponse {
+	frame := data.NewFrame("sessions",
+		data.NewField("id", nil, []string{}),
+		data.NewField("name", nil, []string{}),
+		data.NewField("node", nil, []string{}),
+		data.NewField("ttl", nil, []string{}),
+		data.NewField("behavior", nil, []string{}),
+		data.NewField("lockDelay", nil, []string{}),
+		data.NewField("checks", nil, []string{}),
+		data.NewField("createIndex", nil, []int64{}),
+		data.NewField("key", nil, []string{}),
+		data.NewField("lockIndex", nil, []int64{}),
+	)
+	for _, session := range sessions {
+		row := []interface{}{session.ID, session.Name, session.Node, session.TTL, session.Behavior,
+			session.LockDelay.String(), joinSorted(sessionChecks(session)), int64(session.CreateIndex)}
+
+		sessionLocks := locks[session.ID]
+		if len(sessionLocks) == 0 {
+			frame.AppendRow(append(row, "", int64(0))...)
+			continue
+		}
+		for _, kv := range sessionLocks {
+			frame.AppendRow(append(row[:len(row):len(row)], kv.Key, int64(kv.LockIndex))...)
+		}
+	}
+	return backend.DataResponse{Frames: []*data.Frame{frame}}
+}
+
+// sessionChecks returns the IDs of the node and service checks of the session
+func sessionChecks(session *api.SessionEntry) []string {
+	checks := append([]string{}, session.Checks...)
+	for _, check := range session.NodeChecks {
+		if !containsAll(checks, []string{check}) {
+			checks = append(checks, check)
+		}
+	}
+	for _, check := range session.ServiceChecks {
+		id := check.ID
+		if check.Namespace != "" {
+			id = check.Namespace + "/" + id
+		}
+		checks = append(checks, id)
+	}
+	return checks
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// createTestSessions creates a leader session holding two locks below locks/ and an idle session
+func createTestSessions(t *testing.T, consul *api.Client) (string, string) {
+	leader, _, err := consul.Session().Create(&api.SessionEntry{Name: "leader", TTL: "600s", Behavior: api.SessionBehaviorDelete}, nil)
+	if err != nil {
+		t.Fatalf("could not create session: %v", err)
+	}
+	idle, _, err := consul.Session().Create(&api.SessionEntry{Name: "idle"}, nil)
+	if err != nil {
+		t.Fatalf("could not create session: %v", err)
+	}
+	for _, key := range []string{"locks/leader", "locks/semaphore/1"} {
+		acquired, _, err := consul.KV().Acquire(&api.KVPair{Key: key, Session: leader}, nil)
+		if err != nil || !acquired {
+			t.Fatalf("could not acquire lock %s: %v", key, err)
+		}
+	}
+	return leader, idle
+}
+
+func TestQuerySessions(t *testing.T) {
+	srv, fixtures, instance := sharedTestServer(t)
+
+	response := query(context.TODO(), instance, map[string]queryModel{
+		"table":      {Format: "table", Type: "sessions", LockPrefix: "locks/"},
+		"timeseries": {Format: "timeseries", Type: "sessions", Target: srv.Config.NodeName, LockPrefix: "locks/"},
+		"nolocks":    {Format: "timeseries", Type: "sessions"},
+		"info":       {Format: "table", Type: "session", Target: fixtures.idleSession},
+		"empty":      {Format: "table", Type: "session"},
+	})
+
+	t.Run("table", func(t *testing.T) {
+		res := response.Responses["table"]
+		if res.Error != nil || len(res.Frames) != 1 {
+			t.Fatalf("expected one frame, got %d frames and error %v", len(res.Frames), res.Error)
+		}
+		frame := res.Frames[0]
+		locked := map[string]string{}
+		for i := 0; i < frame.Rows(); i++ {
+			row := frame.RowCopy(i)
+			locked[row[8].(string)] = row[1].(string)
+			if row[1] == "leader" && (row[3] != "600s" || row[4] != api.SessionBehaviorDelete) {
+				t.Errorf("expected ttl and behavior of the leader session, got %v", row)
+			}
+		}
+		if len(locked) != 3 || locked["locks/leader"] != "leader" || locked["locks/semaphore/1"] != "leader" || locked[""] != "idle" {
+			t.Errorf("expected locks of the leader session and a row for the idle session, got %v", locked)
+		}
+	})
+
+	t.Run("timeseries", func(t *testing.T) {
+		res := response.Responses["timeseries"]
+		if res.Error != nil || len(res.Frames) != 2 {
+			t.Fatalf("expected two frames, got %d frames and error %v", len(res.Frames), res.Error)
+		}
+		for _, frame := range res.Frames {
+			expected := 0.0
+			if frame.Fields[1].Labels["name"] == "leader" {
+				expected = 2
+			}
+			if value := frame.Fields[1].At(0); value != expected {
+				t.Errorf("session %s: expected %v locks, got %v", frame.Fields[1].Labels["name"], expected, value)
+			}
+		}
+	})
+
+	t.Run("nolocks", func(t *testing.T) {
+		res := response.Responses["nolocks"]
+		if res.Error != nil || len(res.Frames) != 2 {
+			t.Fatalf("expected two frames, got %d frames and error %v", len(res.Frames), res.Error)
+		}
+		for _, frame := range res.Frames {
+			if value := frame.Fields[1].At(0); value != 0.0 {
+				t.Errorf("session %s: expected no locks without lock prefix, got %v", frame.Fields[1].Labels["name"], value)
+			}
+		}
+	})
+
+	t.Run("info", func(t *testing.T) {
+		res := response.Responses["info"]
+		if res.Error != nil || len(res.Frames) != 1 || res.Frames[0].Rows() != 1 || res.Frames[0].Fields[0].At(0) != fixtures.idleSession {
+			t.Errorf("expected the idle session, got error %v", res.Error)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if res := response.Responses["empty"]; res.Error == nil {
+			t.Errorf("expected error without session ID")
+		}
+	})
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-msgpack/codec"
+)
+
+// snapshotKVSType is the record type of key value entries in the state of a Consul snapshot
+const snapshotKVSType = 2
+
+// snapshotDefaultWaitTime is the wait time of blocking queries without a wait parameter
+const snapshotDefaultWaitTime = 5 * time.Minute
+
+// snapshotStore is an in-memory key value store loaded from a Consul snapshot or JSON exports.
+// The pairs are sorted by key.
+type snapshotStore struct {
+	index uint64
+	pairs []*api.KVPair
+}
+
+// newSnapshotClient returns a Consul client which serves the key value store of the snapshot at path in memory.
+// The path is a snapshot saved with consul snapshot save, a JSON file exported with consul kv export or a
+// directory of those JSON files. The values of JSON files are decoded with encoding: base64 (default, like
+// consul kv export) or raw. Only key value endpoints are available.
+func newSnapshotClient(path, encoding string) (*api.Client, error) {
+	switch encoding {
+	case "":
+		encoding = "base64"
+	case "base64", "raw":
+	default:
+		return nil, fmt.Errorf("unknown snapshot encoding %s", encoding)
+	}
+
+	store, err := loadSnapshot(path, encoding)
+	if err != nil {
+		return nil, err
+	}
+	log.DefaultLogger.Info("newSnapshotClient", "path", path, "keys", len(store.pairs), "index", store.index)
+
+	conf := api.DefaultConfig()
+	conf.Address = "snapshot"
+	conf.Scheme = "http"
+	conf.HttpClient = &http.Client{Transport: &snapshotTransport{store: store}}
+	return newConsulClient(conf)
+}
+
+func loadSnapshot(path, encoding string) (*snapshotStore, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot %s: %v", path, err)
+	}
+
+	var pairs []*api.KVPair
+	var index uint64
+	switch {
+	case info.IsDir():
+		files, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("error listing exports in %s: %v", path, err)
+		}
+		for _, file := range files {
+			exported, err := readKVExport(file, encoding)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, exported...)
+		}
+	case strings.EqualFold(filepath.Ext(path), ".json"):
+		pairs, err = readKVExport(path, encoding)
+	default:
+		pairs, index, err = readSnapshotArchive(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// later pairs replace earlier pairs with the same key
+	byKey := map[string]*api.KVPair{}
+	for _, pair := range pairs {
+		byKey[pair.Key] = pair
+	}
+	store := &snapshotStore{index: index}
+	for _, pair := range byKey {
+		store.pairs = append(store.pairs, pair)
+		if pair.ModifyIndex > store.index {
+			store.index = pair.ModifyIndex
+		}
+	}
+	sort.Slice(store.pairs, func(i, j int) bool {
+		return store.pairs[i].Key < store.pairs[j].Key
+	})
+	if store.index == 0 {
+		store.index = 1
+	}
+	return store, nil
+}
+
+// kvExportEntry is an entry of consul kv export
+type kvExportEntry struct {
+	Key   string `json:"key"`
+	Flags uint64 `json:"flags"`
+	Value string `json:"value"`
+}
+
+// readKVExport reads a JSON file exported with consul kv export. The values are base64 encoded, with the raw
+// encoding they are used as they are, like in example/data/data.json.
+func readKVExport(path, encoding string) ([]*api.KVPair, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading export %s: %v", path, err)
+	}
+	var entries []kvExportEntry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, fmt.Errorf("error decoding export %s: %v", path, err)
+	}
+
+	pairs := make([]*api.KVPair, 0, len(entries))
+	for _, entry := range entries {
+		value := []byte(entry.Value)
+		if encoding == "base64" {
+			if value, err = base64.StdEncoding.DecodeString(entry.Value); err != nil {
+				return nil, fmt.Errorf("error decoding base64 value of %s in export %s: %v", entry.Key, path, err)
+			}
+		}
+		pairs = append(pairs, &api.KVPair{Key: entry.Key, Flags: entry.Flags, Value: value})
+	}
+	return pairs, nil
+}
+
+// readSnapshotArchive reads the key value entries of a snapshot saved with consul snapshot save, a gzipped tar
+// archive with the state of the servers in state.bin. It returns the entries and the last index of the snapshot.
+func readSnapshotArchive(path string) ([]*api.KVPair, uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error opening snapshot %s: %v", path, err)
+	}
+	defer file.Close()
+
+	decompressed, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error decompressing snapshot %s: %v", path, err)
+	}
+	archive := tar.NewReader(decompressed)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil, 0, fmt.Errorf("snapshot %s contains no state.bin", path)
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("error reading snapshot %s: %v", path, err)
+		}
+		if header.Name == "state.bin" {
+			pairs, index, err := readSnapshotState(archive)
+			if err != nil {
+				return nil, 0, fmt.Errorf("error decoding snapshot %s: %v", path, err)
+			}
+			return pairs, index, nil
+		}
+	}
+}
+
+// readSnapshotState reads the key value entries of the msgpack encoded state of a snapshot. The state starts with
+// a header, followed by records which are each prefixed with their type. Records of other types are skipped.
+func readSnapshotState(r io.Reader) ([]*api.KVPair, uint64, error) {
+	reader := bufio.NewReader(r)
+	decoder := codec.NewDecoder(reader, &codec.MsgpackHandle{RawToString: true})
+
+	var header struct {
+		LastIndex uint64
+	}
+	if err := decoder.Decode(&header); err != nil {
+		return nil, 0, fmt.Errorf("error decoding header: %v", err)
+	}
+
+	var pairs []*api.KVPair
+	for {
+		recordType, err := reader.ReadByte()
+		if err == io.EOF {
+			return pairs, header.LastIndex, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if recordType != snapshotKVSType {
+			var record interface{}
+			if err := decoder.Decode(&record); err != nil {
+				return nil, 0, fmt.Errorf("error decoding record of type %d: %v", recordType, err)
+			}
+			continue
+		}
+		var entry struct {
+			Key         string
+			Flags       uint64
+			Value       []byte
+			Session     string
+			LockIndex   uint64
+			CreateIndex uint64
+			ModifyIndex uint64
+		}
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, 0, fmt.Errorf("error decoding key value entry: %v", err)
+		}
+		pairs = append(pairs, &api.KVPair{
+			Key:         entry.Key,
+			Flags:       entry.Flags,
+			Value:       entry.Value,
+			Session:     entry.Session,
+			LockIndex:   entry.LockIndex,
+			CreateIndex: entry.CreateIndex,
+			ModifyIndex: entry.ModifyIndex,
+		})
+	}
+}
+
+// prefixed returns the pairs whose key starts with prefix
+func (s *snapshotStore) prefixed(prefix string) []*api.KVPair {
+	start := sort.Search(len(s.pairs), func(i int) bool {
+		return s.pairs[i].Key >= prefix
+	})
+	end := start
+	for end < len(s.pairs) && strings.HasPrefix(s.pairs[end].Key, prefix) {
+		end++
+	}
+	return s.pairs[start:end]
+}
+
+// keys returns the keys with prefix like the keys endpoint of Consul, keys are truncated after the first
+// separator following the prefix
+func (s *snapshotStore) keys(prefix, separator string) []string {
+	var keys []string
+	for _, pair := range s.prefixed(prefix) {
+		key := pair.Key
+		if separator != "" {
+			if i := strings.Index(key[len(prefix):], separator); i >= 0 {
+				key = key[:len(prefix)+i+len(separator)]
+			}
+		}
+		if len(keys) == 0 || keys[len(keys)-1] != key {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// snapshotTransport serves the key value endpoints of the Consul HTTP API from a snapshotStore.
+// Blocking queries wait until their wait time is over because a snapshot never changes.
+type snapshotTransport struct {
+	store *snapshotStore
+}
+
+func (t *snapshotTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if req.Method != http.MethodGet {
+		return t.response(req, http.StatusMethodNotAllowed, []byte(fmt.Sprintf("%s is not allowed in snapshot mode", req.Method)))
+	}
+
+	switch {
+	case strings.HasPrefix(req.URL.Path, "/v1/kv/"):
+		return t.kv(req)
+	case req.URL.Path == "/v1/status/leader":
+		return t.response(req, http.StatusOK, []byte(`"snapshot"`))
+	}
+	return t.response(req, http.StatusNotImplemented, []byte(fmt.Sprintf("%s is not available in snapshot mode", req.URL.Path)))
+}
+
+func (t *snapshotTransport) kv(req *http.Request) (*http.Response, error) {
+	key := strings.TrimPrefix(req.URL.Path, "/v1/kv/")
+	params := req.URL.Query()
+
+	if index := params.Get("index"); index != "" {
+		waitIndex, err := strconv.ParseUint(index, 10, 64)
+		if err != nil {
+			return t.response(req, http.StatusBadRequest, []byte(fmt.Sprintf("invalid index %s", index)))
+		}
+		if waitIndex >= t.store.index {
+			wait := snapshotDefaultWaitTime
+			if param := params.Get("wait"); param != "" {
+				if wait, err = time.ParseDuration(param); err != nil {
+					return t.response(req, http.StatusBadRequest, []byte(fmt.Sprintf("invalid wait %s", param)))
+				}
+			}
+			select {
+			case <-time.After(wait):
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+		}
+	}
+
+	var result interface{}
+	var found bool
+	if _, ok := params["keys"]; ok {
+		keys := t.store.keys(key, params.Get("separator"))
+		result, found = keys, len(keys) > 0
+	} else if _, ok := params["recurse"]; ok {
+		pairs := t.store.prefixed(key)
+		result, found = pairs, len(pairs) > 0
+	} else {
+		pairs := t.store.prefixed(key)
+		if len(pairs) > 0 && pairs[0].Key == key {
+			result, found = pairs[:1], true
+		}
+	}
+	if !found {
+		return t.response(req, http.StatusNotFound, nil)
+	}
+	content, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return t.response(req, http.StatusOK, content)
+}
+
+// response returns a response with the content and the headers of the Consul HTTP API
+func (t *snapshotTransport) response(req *http.Request, status int, content []byte) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("X-Consul-Index", strconv.FormatUint(t.store.index, 10))
+	header.Set("X-Consul-KnownLeader", "true")
+	header.Set("X-Consul-LastContact", "0")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(content)),
+		ContentLength: int64(len(content)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/hashicorp/consul/api"
+)
+
+func TestSnapshotQueries(t *testing.T) {
+	srv, consul := setupTestServer(t)
+	defer srv.Stop()
+
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	snapshot, _, err := consul.Snapshot().Save(nil)
+	if err != nil {
+		t.Fatalf("could not save snapshot: %v", err)
+	}
+	defer snapshot.Close()
+	path := filepath.Join(dir, "backup.snap")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(file, snapshot); err != nil {
+		t.Fatalf("could not write snapshot: %v", err)
+	}
+	file.Close()
+
+	live, err := newInstanceSettings(consul, jsonData{})
+	if err != nil {
+		t.Fatalf("could not create instance: %v", err)
+	}
+	client, err := newSnapshotClient(path, "")
+	if err != nil {
+		t.Fatalf("could not load snapshot: %v", err)
+	}
+	offline, err := newInstanceSettings(client, jsonData{})
+	if err != nil {
+		t.Fatalf("could not create instance: %v", err)
+	}
+
+	queries := map[string]queryModel{
+		"get":      {Format: "timeseries", Type: "get", Target: "registry/apiregistration.k8s.io/apiservices/v1.apps/spec/groupPriorityMinimum"},
+		"keys":     {Format: "timeseries", Type: "keys", Target: "registry/apiregistration.k8s.io/apiservices/"},
+		"tags":     {Format: "timeseries", Type: "tagsrec", Target: "deployments/"},
+		"table":    {Format: "table", Target: "deployments/*/name", Columns: "../name,../config#replicas"},
+		"metadata": {Format: "table", Target: "deployments/*/name", Columns: "../name,.@modifyIndex", Metadata: true},
+		"missing":  {Format: "timeseries", Type: "get", Target: "missing"},
+	}
+	expected := query(context.TODO(), live, queries)
+	actual := query(context.TODO(), offline, queries)
+
+	for refID := range queries {
+		t.Run(refID, func(t *testing.T) {
+			compareSnapshotResponses(t, expected.Responses[refID], actual.Responses[refID])
+		})
+	}
+
+	t.Run("catalog", func(t *testing.T) {
+		response := query(context.TODO(), offline, map[string]queryModel{"A": {Format: "table", Type: "services"}})
+		if response.Responses["A"].Error == nil {
+			t.Errorf("expected an error for catalog queries in snapshot mode")
+		}
+	})
+}
+
+// compareSnapshotResponses compares the frames of the responses, except the time fields of time series
+func compareSnapshotResponses(t *testing.T, expected, actual backend.DataResponse) {
+	if (expected.Error == nil) != (actual.Error == nil) {
+		t.Fatalf("expected error %v, got %v", expected.Error, actual.Error)
+	}
+	if len(expected.Frames) != len(actual.Frames) {
+		t.Fatalf("expected %d frames, got %d", len(expected.Frames), len(actual.Frames))
+	}
+	for i, frame := range expected.Frames {
+		if frame.Name != actual.Frames[i].Name || len(frame.Fields) != len(actual.Frames[i].Fields) {
+			t.Fatalf("expected frame %s with %d fields, got %s with %d", frame.Name, len(frame.Fields), actual.Frames[i].Name, len(actual.Frames[i].Fields))
+		}
+		for j, field := range frame.Fields {
+			other := actual.Frames[i].Fields[j]
+			if field.Name != other.Name || !reflect.DeepEqual(field.Labels, other.Labels) || field.Len() != other.Len() {
+				t.Fatalf("expected field %s %v, got %s %v", field.Name, field.Labels, other.Name, other.Labels)
+			}
+			for k := 0; k < field.Len(); k++ {
+				if _, ok := field.At(k).(time.Time); ok {
+					continue
+				}
+				if !reflect.DeepEqual(field.At(k), other.At(k)) {
+					t.Errorf("expected %v in field %s of frame %s, got %v", field.At(k), field.Name, frame.Name, other.At(k))
+				}
+			}
+		}
+	}
+}
+
+func TestLoadSnapshotExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	export, err := json.Marshal([]kvExportEntry{
+		{Key: "deployments/web/replicas", Value: base64.StdEncoding.EncodeToString([]byte("3"))},
+		{Key: "deployments/web/image", Flags: 42, Value: base64.StdEncoding.EncodeToString([]byte("web:1.0"))},
+		{Key: "deployments/api/replicas", Value: base64.StdEncoding.EncodeToString([]byte("2"))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "export.json")
+	if err := ioutil.WriteFile(path, export, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("base64", func(t *testing.T) {
+		consul, err := newSnapshotClient(path, "base64")
+		if err != nil {
+			t.Fatalf("could not load export: %v", err)
+		}
+		pair, _, err := consul.KV().Get("deployments/web/image", nil)
+		if err != nil || pair == nil || string(pair.Value) != "web:1.0" || pair.Flags != 42 {
+			t.Fatalf("expected the decoded value web:1.0, got %v (error %v)", pair, err)
+		}
+		keys, _, err := consul.KV().Keys("deployments/", "/", nil)
+		if err != nil || !reflect.DeepEqual(keys, []string{"deployments/api/", "deployments/web/"}) {
+			t.Errorf("expected the deployments as subkeys, got %v (error %v)", keys, err)
+		}
+		pairs, _, err := consul.KV().List("deployments/web/", nil)
+		if err != nil || len(pairs) != 2 {
+			t.Errorf("expected two keys of web, got %v (error %v)", pairs, err)
+		}
+		pair, _, err = consul.KV().Get("deployments/web", nil)
+		if err != nil || pair != nil {
+			t.Errorf("expected no value for a prefix, got %v (error %v)", pair, err)
+		}
+		if _, _, err := consul.KV().Get("deployments/web/replicas", &api.QueryOptions{WaitIndex: 1, WaitTime: 10 * time.Millisecond}); err != nil {
+			t.Errorf("expected blocking queries to return after the wait time, got %v", err)
+		}
+		if _, err := consul.KV().Put(&api.KVPair{Key: "deployments/web/replicas", Value: []byte("4")}, nil); err == nil {
+			t.Errorf("expected an error writing to a snapshot")
+		}
+	})
+
+	t.Run("raw", func(t *testing.T) {
+		consul, err := newSnapshotClient("testdata", "raw")
+		if err != nil {
+			t.Fatalf("could not load exports: %v", err)
+		}
+		pair, _, err := consul.KV().Get("deployments/api/name", nil)
+		if err != nil || pair == nil || string(pair.Value) != "api" {
+			t.Errorf("expected the raw value api, got %v (error %v)", pair, err)
+		}
+	})
+
+	t.Run("raw values which are valid base64", func(t *testing.T) {
+		plain, err := json.Marshal([]kvExportEntry{
+			{Key: "flags/enabled", Value: "true"},
+			{Key: "limits/requests", Value: "1000"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		plainPath := filepath.Join(dir, "plain.json")
+		if err := ioutil.WriteFile(plainPath, plain, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		consul, err := newSnapshotClient(plainPath, "raw")
+		if err != nil {
+			t.Fatalf("could not load export: %v", err)
+		}
+		for key, expected := range map[string]string{"flags/enabled": "true", "limits/requests": "1000"} {
+			pair, _, err := consul.KV().Get(key, nil)
+			if err != nil || pair == nil || string(pair.Value) != expected {
+				t.Errorf("expected the raw value %s of %s, got %v (error %v)", expected, key, pair, err)
+			}
+		}
+	})
+
+	t.Run("invalid base64", func(t *testing.T) {
+		if _, err := newSnapshotClient("testdata", ""); err == nil {
+			t.Errorf("expected an error for raw values with the default base64 encoding")
+		}
+	})
+
+	t.Run("unknown encoding", func(t *testing.T) {
+		if _, err := newSnapshotClient(path, "hex"); err == nil {
+			t.Errorf("expected an error for an unknown encoding")
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		if _, err := newSnapshotClient(filepath.Join(dir, "missing.snap"), ""); err == nil {
+			t.Errorf("expected an error for a missing snapshot")
+		}
+	})
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/live"
+	"github.com/hashicorp/consul/api"
+)
+
+const (
+	// streamWaitTime is the maximum time a blocking query waits for a change
+	streamWaitTime = 5 * time.Minute
+	// streamRetryInterval is the time to wait before retrying a failed blocking query
+	streamRetryInterval = 5 * time.Second
+)
+
+// streamQuery is the query which is encoded in the path of a live channel.
+type streamQuery struct {
+	Datacenter  string
+	Namespace   string
+	Partition   string
+	Type        string
+	Target      string
+	ValueFormat string
+	Path        string
+}
+
+// streamPath returns the path of the live channel for a query.
+// The path has the format [dc=<datacenter>/][ns=<namespace>/][ap=<partition>/]<type>[=<value format>[=<path>]]/<target>,
+// e.g. get/registry/apiservices/v1.apps/kind or dc=dc2/get=yaml=spec.replicas/deployments/web
+func streamPath(query queryModel) (string, error) {
+	if query.Alerting {
+		return "", fmt.Errorf("live is not supported in alerting mode")
+	}
+	if query.History {
+		return "", fmt.Errorf("live is not supported for history queries")
+	}
+	if query.Metadata {
+		return "", fmt.Errorf("live is not supported with metadata")
+	}
+
+	queryType := query.Type
+	if queryType == "" {
+		queryType = "get"
+	}
+	switch queryType {
+	case "get", "tags", "tagsrec":
+	default:
+		return "", fmt.Errorf("live is not supported for query type %s", queryType)
+	}
+
+	if name, _ := multiValueVariable(query); name != "" {
+		return "", fmt.Errorf("live is not supported for the multi-value variable %s", name)
+	}
+
+	target := strings.Replace(interpolateVariables(query.Target, query.ScopedVars), "\\.", ".", -1)
+	target = strings.Trim(target, "/")
+	if target == "" {
+		return "", fmt.Errorf("live requires a target")
+	}
+	if query.ValueFormat != "" || query.Path != "" {
+		if queryType != "get" {
+			return "", fmt.Errorf("live supports a value format and path only for query type get")
+		}
+		if strings.Contains(query.Path, "/") {
+			return "", fmt.Errorf("live does not support a path containing /")
+		}
+		valueFormat := query.ValueFormat
+		if valueFormat == "" {
+			valueFormat = "auto"
+		}
+		queryType += "=" + valueFormat
+		if query.Path != "" {
+			queryType += "=" + query.Path
+		}
+	}
+
+	if query.Datacenter == allDatacenters || query.Namespace == allNamespaces {
+		return "", fmt.Errorf("live is not supported for all datacenters or namespaces")
+	}
+	var prefix string
+	for _, segment := range []struct{ key, value string }{
+		{"dc", query.Datacenter},
+		{"ns", query.Namespace},
+		{"ap", query.Partition},
+	} {
+		if segment.value != "" {
+			prefix += segment.key + "=" + segment.value + "/"
+		}
+	}
+	return prefix + queryType + "/" + target, nil
+}
+
+// parseStreamPath parses the path of a live channel created by streamPath.
+func parseStreamPath(path string) (streamQuery, error) {
+	stream := streamQuery{}
+	for _, segment := range []struct {
+		key   string
+		value *string
+	}{
+		{"dc=", &stream.Datacenter},
+		{"ns=", &stream.Namespace},
+		{"ap=", &stream.Partition},
+	} {
+		if !strings.HasPrefix(path, segment.key) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(path, segment.key), "/", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return streamQuery{}, fmt.Errorf("invalid stream path %s", path)
+		}
+		*segment.value, path = parts[0], parts[1]
+	}
+
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return streamQuery{}, fmt.Errorf("invalid stream path %s", path)
+	}
+	stream.Target = parts[1]
+	typeAndPath := strings.SplitN(parts[0], "=", 3)
+	stream.Type = typeAndPath[0]
+	if len(typeAndPath) > 1 {
+		stream.ValueFormat = typeAndPath[1]
+	}
+	if len(typeAndPath) > 2 {
+		stream.Path = typeAndPath[2]
+	}
+
+	switch stream.Type {
+	case "get", "tags", "tagsrec":
+	default:
+		return streamQuery{}, fmt.Errorf("invalid stream type %s", stream.Type)
+	}
+	return stream, nil
+}
+
+// setStreamChannels adds the live channel to the frames of all queries which have live enabled.
+// Grafana subscribes to the channel and appends the frames sent by RunStream to the panel.
+func setStreamChannels(pluginCtx backend.PluginContext, queries map[string]queryModel, response *backend.QueryDataResponse) {
+	if pluginCtx.DataSourceInstanceSettings == nil {
+		return
+	}
+
+	for refID, query := range queries {
+		res, ok := response.Responses[refID]
+		if !query.Live || !ok || res.Error != nil {
+			continue
+		}
+
+		path, err := streamPath(query)
+		if err != nil {
+			response.Responses[refID] = backend.DataResponse{Error: err}
+			continue
+		}
+		channel := live.Channel{
+			Scope:     live.ScopeDatasource,
+			Namespace: pluginCtx.DataSourceInstanceSettings.UID,
+			Path:      path,
+		}
+		if !channel.IsValid() {
+			response.Responses[refID] = backend.DataResponse{Error: fmt.Errorf("target %s cannot be used as live channel", query.Target)}
+			continue
+		}
+
+		for _, frame := range res.Frames {
+			if frame.Meta == nil {
+				frame.Meta = &data.FrameMeta{}
+			}
+			frame.Meta.Channel = channel.String()
+		}
+	}
+}
+
+// SubscribeStream is called when a panel subscribes to a live channel.
+func (td *ConsulDataSource) SubscribeStream(ctx context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+	log.DefaultLogger.Debug("SubscribeStream", "path", req.Path)
+
+	if _, err := parseStreamPath(req.Path); err != nil {
+		log.DefaultLogger.Warn("SubscribeStream", "path", req.Path, "err", err)
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+	return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusOK}, nil
+}
+
+// PublishStream is called when a client publishes to a live channel.
+// Consul data is read-only, so publishing is never allowed.
+func (td *ConsulDataSource) PublishStream(ctx context.Context, req *backend.PublishStreamRequest) (*backend.PublishStreamResponse, error) {
+	return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, nil
+}
+
+// RunStream is called once per live channel as long as there are subscribers.
+// It executes Consul blocking queries and sends a new frame every time the data changes.
+func (td *ConsulDataSource) RunStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+	log.DefaultLogger.Debug("RunStream", "path", req.Path)
+
+	instance, err := td.getInstance(req.PluginContext)
+	if err != nil {
+		return err
+	}
+	consul := instance.consul
+
+	stream, err := parseStreamPath(req.Path)
+	if err != nil {
+		return err
+	}
+	stream.Datacenter = firstNonEmpty(stream.Datacenter, instance.datacenter)
+	stream.Namespace = firstNonEmpty(stream.Namespace, instance.namespace)
+	stream.Partition = firstNonEmpty(stream.Partition, instance.partition)
+
+	err = runBlockingQuery(ctx, "RunStream", streamRetryInterval, []interface{}{"path", req.Path}, func(waitIndex uint64) (uint64, func() error, error) {
+		response, lastIndex, err := watchKV(ctx, consul, stream, waitIndex)
+		return lastIndex, func() error {
+			if response.Error != nil {
+				log.DefaultLogger.Warn("RunStream: could not generate frames", "path", req.Path, "err", response.Error)
+				return nil
+			}
+			for _, frame := range response.Frames {
+				if err := sender.SendFrame(frame, data.IncludeAll); err != nil {
+					return fmt.Errorf("error sending frame: %v", err)
+				}
+			}
+			return nil
+		}, err
+	})
+	if err == nil {
+		log.DefaultLogger.Debug("RunStream: stream stopped", "path", req.Path)
+	}
+	return err
+}
+
+// runBlockingQuery executes a Consul blocking query again and again until ctx is done. query waits for
+// a change after waitIndex and returns the index of its result and a function handling the changed result,
+// which is only called if the index changed. Failed queries are logged with the name and logArgs of the
+// caller and retried after retryInterval. runBlockingQuery returns the first error of a change handler.
+func runBlockingQuery(ctx context.Context, name string, retryInterval time.Duration, logArgs []interface{}, query func(waitIndex uint64) (uint64, func() error, error)) error {
+	var waitIndex uint64
+	for {
+		lastIndex, changed, err := query(waitIndex)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			log.DefaultLogger.Error(name+": blocking query failed", append(logArgs, "err", err)...)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(retryInterval):
+			}
+			continue
+		}
+
+		// Nothing changed, the wait time of the blocking query elapsed
+		if lastIndex == waitIndex {
+			continue
+		}
+		// The index went backwards (e.g. after a snapshot restore), start over
+		if lastIndex < waitIndex {
+			waitIndex = 0
+			continue
+		}
+		waitIndex = lastIndex
+
+		if err := changed(); err != nil {
+			return err
+		}
+	}
+}
+
+// watchKV executes a blocking query for the stream. It returns when the data of the stream
+// changed after waitIndex or when the wait time elapsed.
+func watchKV(ctx context.Context, consul *api.Client, stream streamQuery, waitIndex uint64) (backend.DataResponse, uint64, error) {
+	log.DefaultLogger.Debug("watchKV", "type", stream.Type, "target", stream.Target, "waitIndex", waitIndex)
+
+	opts := (&api.QueryOptions{
+		Datacenter: stream.Datacenter,
+		Namespace:  stream.Namespace,
+		Partition:  stream.Partition,
+		WaitIndex:  waitIndex,
+		WaitTime:   streamWaitTime,
+	}).WithContext(ctx)
+
+	if stream.Type == "get" {
+		var kvs []*api.KVPair
+		kv, meta, err := consul.KV().Get(stream.Target, opts)
+		if err != nil {
+			return backend.DataResponse{}, 0, fmt.Errorf("error consul get %s: %v", stream.Target, err)
+		}
+		if kv != nil {
+			kvs = append(kvs, kv)
+		}
+		return generateDataResponseFromKV(kvs, stream.ValueFormat, stream.Path), meta.LastIndex, nil
+	}
+
+	prefix := stream.Target + "/"
+	kvs, meta, err := consul.KV().List(prefix, opts)
+	if err != nil {
+		return backend.DataResponse{}, 0, fmt.Errorf("error consul list %s: %v", prefix, err)
+	}
+
+	// tags only contains the direct subkeys, tagsrec all subkeys
+	var tagKVs []*api.KVPair
+	for _, kv := range kvs {
+		if stream.Type == "tags" && strings.Contains(strings.TrimPrefix(kv.Key, prefix), "/") {
+			continue
+		}
+		tagKVs = append(tagKVs, kv)
+	}
+	return generateDataResponseWithTags(prefix, tagKVs), meta.LastIndex, nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func TestStreamPath(t *testing.T) {
+	var tests = []struct {
+		name    string
+		query   queryModel
+		path    string
+		wantErr bool
+	}{
+		{
+			name:  "get",
+			query: queryModel{Type: "get", Target: "flags/rollout/percentage"},
+			path:  "get/flags/rollout/percentage",
+		},
+		{
+			name:  "default type with escaped dots and trailing slash",
+			query: queryModel{Target: "flags/v1\\.apps/"},
+			path:  "get/flags/v1.apps",
+		},
+		{
+			name:  "tagsrec",
+			query: queryModel{Type: "tagsrec", Target: "flags/"},
+			path:  "tagsrec/flags",
+		},
+		{
+			name:  "get with path",
+			query: queryModel{Type: "get", Target: "deployments/web/config", Path: "spec.replicas"},
+			path:  "get=auto=spec.replicas/deployments/web/config",
+		},
+		{
+			name:  "get with value format",
+			query: queryModel{Type: "get", Target: "deployments/web/replicas", ValueFormat: "base64"},
+			path:  "get=base64/deployments/web/replicas",
+		},
+		{
+			name:  "get in datacenter",
+			query: queryModel{Type: "get", Target: "flags/rollout/percentage", Datacenter: "dc2"},
+			path:  "dc=dc2/get/flags/rollout/percentage",
+		},
+		{
+			name:  "get in namespace and partition",
+			query: queryModel{Type: "get", Target: "flags/rollout/percentage", Datacenter: "dc2", Namespace: "team-a", Partition: "web"},
+			path:  "dc=dc2/ns=team-a/ap=web/get/flags/rollout/percentage",
+		},
+		{
+			name:  "tags in partition",
+			query: queryModel{Type: "tags", Target: "flags", Partition: "web"},
+			path:  "ap=web/tags/flags",
+		},
+		{
+			name:  "get with variable",
+			query: queryModel{Type: "get", Target: "flags/$flag/percentage", ScopedVars: map[string]scopedVar{"flag": {Value: variableValues{"rollout"}}}},
+			path:  "get/flags/rollout/percentage",
+		},
+		{
+			name:    "multi-value variables are not supported",
+			query:   queryModel{Type: "get", Target: "flags/$flag/percentage", ScopedVars: map[string]scopedVar{"flag": {Value: variableValues{"rollout", "canary"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "all namespaces are not supported",
+			query:   queryModel{Type: "get", Target: "flags/rollout/percentage", Namespace: "*"},
+			wantErr: true,
+		},
+		{
+			name:    "all datacenters are not supported",
+			query:   queryModel{Type: "get", Target: "flags/rollout/percentage", Datacenter: "*"},
+			wantErr: true,
+		},
+		{
+			name:    "tags with path",
+			query:   queryModel{Type: "tags", Target: "deployments/web", Path: "spec.replicas"},
+			wantErr: true,
+		},
+		{
+			name:    "alerting is not supported",
+			query:   queryModel{Type: "get", Target: "flags/rollout/percentage", Alerting: true},
+			wantErr: true,
+		},
+		{
+			name:    "keys are not supported",
+			query:   queryModel{Type: "keys", Target: "flags"},
+			wantErr: true,
+		},
+		{
+			name:    "empty target",
+			query:   queryModel{Type: "get", Target: "/"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := streamPath(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if path != tt.path {
+				t.Errorf("expected path %q, got %q", tt.path, path)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			stream, err := parseStreamPath(path)
+			if err != nil {
+				t.Fatalf("could not parse stream path %s: %v", path, err)
+			}
+			queryType := tt.query.Type
+			if queryType == "" {
+				queryType = "get"
+			}
+			valueFormat := tt.query.ValueFormat
+			if valueFormat == "" && tt.query.Path != "" {
+				valueFormat = "auto"
+			}
+			if stream.Datacenter != tt.query.Datacenter || stream.Namespace != tt.query.Namespace || stream.Partition != tt.query.Partition || stream.Type != queryType || stream.ValueFormat != valueFormat || stream.Path != tt.query.Path || !strings.HasSuffix(path, "/"+stream.Target) {
+				t.Errorf("stream %+v does not match query %+v", stream, tt.query)
+			}
+		})
+	}
+}
+
+func TestWatchKV(t *testing.T) {
+	srv, consul := setupTestServer(t)
+	defer srv.Stop()
+
+	key := "flags/rollout/percentage"
+	if _, err := consul.KV().Put(&api.KVPair{Key: key, Value: []byte("10")}, nil); err != nil {
+		t.Fatalf("could not put key %s: %v", key, err)
+	}
+
+	stream := streamQuery{Type: "get", Target: key}
+	response, index, err := watchKV(context.TODO(), consul, stream, 0)
+	if err != nil {
+		t.Fatalf("error watching %s: %v", key, err)
+	}
+	if response.Error != nil || len(response.Frames) != 1 {
+		t.Fatalf("expected one frame, got %+v", response)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		if _, err := consul.KV().Put(&api.KVPair{Key: key, Value: []byte("20")}, nil); err != nil {
+			t.Errorf("could not put key %s: %v", key, err)
+		}
+	}()
+
+	response, newIndex, err := watchKV(context.TODO(), consul, stream, index)
+	if err != nil {
+		t.Fatalf("error watching %s: %v", key, err)
+	}
+	if newIndex <= index {
+		t.Errorf("expected index to be greater than %d, got %d", index, newIndex)
+	}
+	if value := response.Frames[0].Fields[1].At(0); value != float64(20) {
+		t.Errorf("expected value 20, got %v", value)
+	}
+}
+
+func TestRunBlockingQuery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	// the index is unchanged when the wait time elapsed and goes backwards after a snapshot restore
+	indexes := []uint64{5, 5, 3, 7}
+	var waitIndexes, changed []uint64
+	err := runBlockingQuery(ctx, "test", time.Millisecond, nil, func(waitIndex uint64) (uint64, func() error, error) {
+		waitIndexes = append(waitIndexes, waitIndex)
+		if len(indexes) == 0 {
+			cancel()
+			return 0, nil, ctx.Err()
+		}
+		index := indexes[0]
+		indexes = indexes[1:]
+		return index, func() error {
+			changed = append(changed, index)
+			return nil
+		}, nil
+	})
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(waitIndexes, []uint64{0, 5, 5, 0, 7}) {
+		t.Errorf("unexpected wait indexes %v", waitIndexes)
+	}
+	if !reflect.DeepEqual(changed, []uint64{5, 7}) {
+		t.Errorf("expected changes only for new indexes, got %v", changed)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// variableRegex matches $name, ${name}, ${name:format} and [[name]] like the template service of Grafana
+var variableRegex = regexp.MustCompile(`\$(\w+)|\$\{(\w+)(?::(\w+))?\}|\[\[(\w+)(?::(\w+))?\]\]`)
+
+// scopedVar is a variable sent with the query, the value is a single value or the
+// selected values of a multi-value variable.
+type scopedVar struct {
+	Value variableValues `json:"value"`
+}
+
+type variableValues []string
+
+// UnmarshalJSON accepts a single value or a list of values. Numbers and booleans are converted to strings.
+func (v *variableValues) UnmarshalJSON(b []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	var values []interface{}
+	switch raw := raw.(type) {
+	case nil:
+		values = nil
+	case []interface{}:
+		values = raw
+	default:
+		values = []interface{}{raw}
+	}
+
+	*v = variableValues{}
+	for _, value := range values {
+		switch value := value.(type) {
+		case string:
+			*v = append(*v, value)
+		case float64:
+			*v = append(*v, strconv.FormatFloat(value, 'f', -1, 64))
+		case bool:
+			*v = append(*v, strconv.FormatBool(value))
+		default:
+			return fmt.Errorf("unsupported variable value %v", value)
+		}
+	}
+	return nil
+}
+
+// runTemplatedQuery interpolates the variables in the target and the columns of the query.
+// A multi-value variable is expanded into one query per value, the frames of these queries
+// are merged and labeled with the variable name and value.
+func runTemplatedQuery(ctx context.Context, instance *instanceSettings, query queryModel) backend.DataResponse {
+	name, values := multiValueVariable(query)
+	if name == "" {
+		query.Target = interpolateVariables(query.Target, query.ScopedVars)
+		query.Columns = interpolateVariables(query.Columns, query.ScopedVars)
+		// the variables are not needed anymore and would only fragment the cache
+		query.ScopedVars = nil
+
+		if query.Datacenter == allDatacenters {
+			return queryAllDatacenters(ctx, instance, query)
+		}
+		return runDatacenterQuery(ctx, instance, query)
+	}
+
+	log.DefaultLogger.Debug("runTemplatedQuery", "variable", name, "values", values)
+
+	return fanOut(name, values, func(value string) backend.DataResponse {
+		valueQuery := query
+		valueQuery.ScopedVars = map[string]scopedVar{}
+		for k, v := range query.ScopedVars {
+			valueQuery.ScopedVars[k] = v
+		}
+		valueQuery.ScopedVars[name] = scopedVar{Value: variableValues{value}}
+		return runTemplatedQuery(ctx, instance, valueQuery)
+	})
+}
+
+// multiValueVariable returns the first variable with multiple values which is used in the
+// target or the columns of the query without a format.
+func multiValueVariable(query queryModel) (string, []string) {
+	for _, s := range []string{query.Target, query.Columns} {
+		for _, match := range variableRegex.FindAllStringSubmatch(s, -1) {
+			name, format := variableMatch(match)
+			if format != "" {
+				continue
+			}
+			if variable, ok := query.ScopedVars[name]; ok && len(variable.Value) > 1 {
+				return name, variable.Value
+			}
+		}
+	}
+	return "", nil
+}
+
+// interpolateVariables replaces the variables in s by their values. Variables with multiple values
+// are joined according to their format: csv, pipe, glob, regex or json. Unknown variables are not replaced.
+func interpolateVariables(s string, vars map[string]scopedVar) string {
+	if len(vars) == 0 {
+		return s
+	}
+	return variableRegex.ReplaceAllStringFunc(s, func(m string) string {
+		name, format := variableMatch(variableRegex.FindStringSubmatch(m))
+		variable, ok := vars[name]
+		if !ok {
+			return m
+		}
+		return formatVariable(variable.Value, format)
+	})
+}
+
+func variableMatch(match []string) (string, string) {
+	switch {
+	case match[1] != "":
+		return match[1], ""
+	case match[2] != "":
+		return match[2], match[3]
+	default:
+		return match[4], match[5]
+	}
+}
+
+func formatVariable(values []string, format string) string {
+	switch format {
+	case "pipe":
+		return strings.Join(values, "|")
+	case "glob":
+		if len(values) == 1 {
+			return values[0]
+		}
+		return "{" + strings.Join(values, ",") + "}"
+	case "regex":
+		quoted := make([]string, len(values))
+		for i, value := range values {
+			quoted[i] = regexp.QuoteMeta(value)
+		}
+		if len(quoted) == 1 {
+			return quoted[0]
+		}
+		return "(" + strings.Join(quoted, "|") + ")"
+	case "json":
+		b, _ := json.Marshal(values)
+		return string(b)
+	}
+	return strings.Join(values, ",")
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func TestInterpolateVariables(t *testing.T) {
+	vars := map[string]scopedVar{
+		"app":     {Value: variableValues{"web"}},
+		"apps":    {Value: variableValues{"api", "web"}},
+		"version": {Value: variableValues{"v1.2"}},
+	}
+
+	var tests = []struct {
+		s        string
+		expected string
+	}{
+		{s: "deployments/$app/name", expected: "deployments/web/name"},
+		{s: "deployments/${app}/name", expected: "deployments/web/name"},
+		{s: "deployments/[[app]]/name", expected: "deployments/web/name"},
+		{s: "deployments/$unknown/name", expected: "deployments/$unknown/name"},
+		{s: "../$app,../config", expected: "../web,../config"},
+		{s: "${apps:csv}", expected: "api,web"},
+		{s: "${apps:pipe}", expected: "api|web"},
+		{s: "[[apps:glob]]", expected: "{api,web}"},
+		{s: "${apps:regex}", expected: "(api|web)"},
+		{s: "${version:regex}", expected: `v1\.2`},
+		{s: "${apps:json}", expected: `["api","web"]`},
+	}
+
+	for _, tt := range tests {
+		if actual := interpolateVariables(tt.s, vars); actual != tt.expected {
+			t.Errorf("interpolateVariables(%q): expected %q, got %q", tt.s, tt.expected, actual)
+		}
+	}
+}
+
+func TestMultiValueVariable(t *testing.T) {
+	vars := map[string]scopedVar{
+		"app":  {Value: variableValues{"web"}},
+		"apps": {Value: variableValues{"api", "web"}},
+	}
+
+	var tests = []struct {
+		query          queryModel
+		expectedName   string
+		expectedValues []string
+	}{
+		{query: queryModel{Target: "deployments/$app/name", ScopedVars: vars}},
+		{query: queryModel{Target: "deployments/$apps/name", ScopedVars: vars}, expectedName: "apps", expectedValues: []string{"api", "web"}},
+		{query: queryModel{Target: "deployments/*/name", Columns: "../../$apps/name", ScopedVars: vars}, expectedName: "apps", expectedValues: []string{"api", "web"}},
+		{query: queryModel{Target: "deployments/${apps:regex}/name", ScopedVars: vars}},
+	}
+
+	for _, tt := range tests {
+		name, values := multiValueVariable(tt.query)
+		if name != tt.expectedName || !reflect.DeepEqual(values, tt.expectedValues) {
+			t.Errorf("multiValueVariable(%q, %q): expected %s %v, got %s %v", tt.query.Target, tt.query.Columns, tt.expectedName, tt.expectedValues, name, values)
+		}
+	}
+}
+
+func TestUnmarshalScopedVars(t *testing.T) {
+	var query queryModel
+	err := json.Unmarshal([]byte(`{"scopedVars":{"app":{"text":"web","value":"web"},"apps":{"text":"api + web","value":["api","web"]},"interval":{"value":1000}}}`), &query)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]scopedVar{
+		"app":      {Value: variableValues{"web"}},
+		"apps":     {Value: variableValues{"api", "web"}},
+		"interval": {Value: variableValues{"1000"}},
+	}
+	if !reflect.DeepEqual(query.ScopedVars, expected) {
+		t.Errorf("expected %v, got %v", expected, query.ScopedVars)
+	}
+}
+
+func TestQueryMultiValueVariable(t *testing.T) {
+	srv, consul := setupTestServer(t)
+	defer srv.Stop()
+
+	// keys may contain a $ which is not a variable
+	if _, err := consul.KV().Put(&api.KVPair{Key: "prices/$usd", Value: []byte("3")}, nil); err != nil {
+		t.Fatalf("could not put key: %v", err)
+	}
+
+	instance, err := newInstanceSettings(consul, jsonData{})
+	if err != nil {
+		t.Fatalf("could not create instance: %v", err)
+	}
+
+	response := query(context.TODO(), instance, map[string]queryModel{
+		"A": {
+			Format: "timeseries",
+			Type:   "get",
+			Target: "deployments/$app/name",
+			ScopedVars: map[string]scopedVar{
+				"app": {Value: variableValues{"api", "web"}},
+			},
+			ValueFormat: "raw",
+		},
+		"B": {
+			Format: "timeseries",
+			Type:   "get",
+			Target: "prices/$usd",
+			ScopedVars: map[string]scopedVar{
+				"app": {Value: variableValues{"web"}},
+			},
+		},
+	})
+
+	if res := response.Responses["B"]; res.Error != nil || len(res.Frames) != 1 || res.Frames[0].Fields[1].At(0) != 3.0 {
+		t.Errorf("expected the value of prices/$usd, got error %v", res.Error)
+	}
+
+	res := response.Responses["A"]
+	if res.Error != nil || len(res.Frames) != 2 {
+		t.Fatalf("expected two frames, got %d frames and error %v", len(res.Frames), res.Error)
+	}
+	for i, app := range []string{"api", "web"} {
+		if label := res.Frames[i].Fields[1].Labels["app"]; label != app {
+			t.Errorf("frame %d: expected label app=%s, got %q", i, app, label)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// setTLSConfig sets the TLS settings of the datasource in the TLS configuration of the Consul client.
+// Settings which are not configured in the datasource keep their defaults, e.g. from CONSUL_CACERT or
+// CONSUL_TLS_SERVER_NAME. The certificates are validated, so wrong certificates are reported when the
+// datasource is saved and not with the first request to Consul.
+func setTLSConfig(conf *api.TLSConfig, jData jsonData, secureJSONData map[string]string) error {
+	if jData.ServerName != "" {
+		conf.Address = jData.ServerName
+	}
+	if jData.TLSSkipVerify {
+		conf.InsecureSkipVerify = true
+	}
+
+	if jData.TLSAuthWithCACert {
+		caCert := secureJSONData["tlsCACert"]
+		if caCert == "" {
+			return fmt.Errorf("CA certificate should not be empty")
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM([]byte(caCert)) {
+			return fmt.Errorf("CA certificate is not a valid PEM-encoded certificate")
+		}
+		// CA files take precedence over the PEM
+		conf.CAFile = ""
+		conf.CAPath = ""
+		conf.CAPem = []byte(caCert)
+	}
+
+	if jData.TLSAuth {
+		clientCert := secureJSONData["tlsClientCert"]
+		clientKey := secureJSONData["tlsClientKey"]
+		if clientCert == "" || clientKey == "" {
+			return fmt.Errorf("client certificate and client key should not be empty")
+		}
+		if _, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey)); err != nil {
+			return fmt.Errorf("invalid client certificate or key: %v", err)
+		}
+		// certificate files take precedence over the PEMs
+		conf.CertFile = ""
+		conf.KeyFile = ""
+		conf.CertPEM = []byte(clientCert)
+		conf.KeyPEM = []byte(clientKey)
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/datasource"
+	"github.com/hashicorp/consul/api"
+)
+
+func TestTLSConfig(t *testing.T) {
+	cert, key := generateCertificate(t)
+
+	// the defaults of the environment, e.g. CONSUL_CACERT and CONSUL_TLS_SERVER_NAME
+	defaults := api.TLSConfig{Address: "consul.env.example.com", CAFile: "/etc/consul/ca.pem", CertFile: "/etc/consul/client.pem", KeyFile: "/etc/consul/client-key.pem"}
+
+	tests := []struct {
+		name     string
+		jData    jsonData
+		secure   map[string]string
+		expected api.TLSConfig
+		err      string
+	}{
+		{
+			name:     "defaults",
+			expected: defaults,
+		},
+		{
+			name:     "skip verify",
+			jData:    jsonData{TLSSkipVerify: true, ServerName: "consul.example.com"},
+			expected: api.TLSConfig{Address: "consul.example.com", InsecureSkipVerify: true, CAFile: defaults.CAFile, CertFile: defaults.CertFile, KeyFile: defaults.KeyFile},
+		},
+		{
+			name:     "ca cert",
+			jData:    jsonData{TLSAuthWithCACert: true},
+			secure:   map[string]string{"tlsCACert": cert},
+			expected: api.TLSConfig{Address: defaults.Address, CAPem: []byte(cert), CertFile: defaults.CertFile, KeyFile: defaults.KeyFile},
+		},
+		{
+			name:  "missing ca cert",
+			jData: jsonData{TLSAuthWithCACert: true},
+			err:   "CA certificate should not be empty",
+		},
+		{
+			name:   "invalid ca cert",
+			jData:  jsonData{TLSAuthWithCACert: true},
+			secure: map[string]string{"tlsCACert": "invalid"},
+			err:    "CA certificate is not a valid PEM-encoded certificate",
+		},
+		{
+			name:     "client cert",
+			jData:    jsonData{TLSAuth: true},
+			secure:   map[string]string{"tlsClientCert": cert, "tlsClientKey": key},
+			expected: api.TLSConfig{Address: defaults.Address, CAFile: defaults.CAFile, CertPEM: []byte(cert), KeyPEM: []byte(key)},
+		},
+		{
+			name:   "missing client key",
+			jData:  jsonData{TLSAuth: true},
+			secure: map[string]string{"tlsClientCert": cert},
+			err:    "client certificate and client key should not be empty",
+		},
+		{
+			name:   "client key does not match",
+			jData:  jsonData{TLSAuth: true},
+			secure: map[string]string{"tlsClientCert": cert, "tlsClientKey": "invalid"},
+			err:    "invalid client certificate or key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := defaults
+			err := setTLSConfig(&conf, tt.jData, tt.secure)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(conf, tt.expected) {
+				t.Errorf("expected TLS config %+v, got %+v", tt.expected, conf)
+			}
+		})
+	}
+}
+
+func TestCheckHealthInvalidTLSSettings(t *testing.T) {
+	ds := &ConsulDataSource{
+		im: datasource.NewInstanceManager(newDataSourceInstance),
+	}
+
+	result, err := ds.CheckHealth(context.TODO(), &backend.CheckHealthRequest{
+		PluginContext: backend.PluginContext{
+			DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{
+				JSONData:                []byte(`{"consulAddr":"https://localhost:8501","tlsAuthWithCACert":true}`),
+				DecryptedSecureJSONData: map[string]string{"tlsCACert": "invalid"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Status != backend.HealthStatusError || !strings.Contains(result.Message, "CA certificate") {
+		t.Errorf("expected error status with CA certificate message, got %v: %s", result.Status, result.Message)
+	}
+}
+
+// generateCertificate returns a self-signed PEM-encoded certificate and its key
+func generateCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "consul"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("could not marshal key: %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return string(certPEM), string(keyPEM)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/hashicorp/hcl"
+	"github.com/tidwall/gjson"
+	"sigs.k8s.io/yaml"
+)
+
+// decodeValue decodes a value in the given format to a JSON document, so it can be addressed
+// by a path. If format is empty or auto, the format is detected. Values which cannot be
+// decoded in any format are returned as JSON string.
+func decodeValue(value []byte, format string) ([]byte, error) {
+	switch format {
+	case "", "auto":
+		return detectAndDecodeValue(value), nil
+	case "json":
+		if !gjson.ValidBytes(value) {
+			return nil, fmt.Errorf("value is not valid JSON")
+		}
+		return value, nil
+	case "yaml":
+		doc, err := yaml.YAMLToJSON(value)
+		if err != nil {
+			return nil, fmt.Errorf("value is not valid YAML: %v", err)
+		}
+		return doc, nil
+	case "toml":
+		var doc map[string]interface{}
+		if _, err := toml.Decode(string(value), &doc); err != nil {
+			return nil, fmt.Errorf("value is not valid TOML: %v", err)
+		}
+		return json.Marshal(doc)
+	case "hcl":
+		var doc map[string]interface{}
+		if err := hcl.Unmarshal(value, &doc); err != nil {
+			return nil, fmt.Errorf("value is not valid HCL: %v", err)
+		}
+		return json.Marshal(unwrapHCLBlocks(doc))
+	case "base64":
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(value)))
+		if err != nil {
+			return nil, fmt.Errorf("value is not valid base64: %v", err)
+		}
+		return detectAndDecodeValue(decoded), nil
+	case "raw":
+		return json.Marshal(string(value))
+	}
+	return nil, fmt.Errorf("unknown value format %s", format)
+}
+
+// unwrapHCLBlocks replaces the lists HCL wraps blocks in by objects, so the paths of HCL values match the
+// ones of the same document in JSON, e.g. service.web.port instead of service.0.web.0.port. A list is only
+// replaced if its blocks have different labels, the blocks of e.g. repeated unlabeled blocks stay a list.
+func unwrapHCLBlocks(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, element := range value {
+			value[key] = unwrapHCLBlocks(element)
+		}
+		return value
+	case []map[string]interface{}:
+		merged := map[string]interface{}{}
+		for _, block := range value {
+			for key, element := range block {
+				if _, ok := merged[key]; ok {
+					list := make([]interface{}, len(value))
+					for i, block := range value {
+						list[i] = unwrapHCLBlocks(block)
+					}
+					return list
+				}
+				merged[key] = element
+			}
+		}
+		return unwrapHCLBlocks(merged)
+	case []interface{}:
+		for i, element := range value {
+			value[i] = unwrapHCLBlocks(element)
+		}
+		return value
+	}
+	return value
+}
+
+// detectAndDecodeValue tries to decode value as JSON, YAML, TOML and HCL in this order.
+// YAML is only used if the document is an object or an array, because every string is a valid YAML scalar.
+func detectAndDecodeValue(value []byte) []byte {
+	if gjson.ValidBytes(value) {
+		return value
+	}
+	if len(bytes.TrimSpace(value)) == 0 {
+		doc, _ := json.Marshal(string(value))
+		return doc
+	}
+	if doc, err := yaml.YAMLToJSON(value); err == nil && (bytes.HasPrefix(doc, []byte("{")) || bytes.HasPrefix(doc, []byte("["))) {
+		return doc
+	}
+	for _, format := range []string{"toml", "hcl"} {
+		if doc, err := decodeValue(value, format); err == nil {
+			return doc
+		}
+	}
+	doc, _ := json.Marshal(string(value))
+	return doc
+}
+
+// extractValues returns the values at path in the value decoded with format.
+// The path uses the gjson syntax (https://github.com/tidwall/gjson/blob/master/SYNTAX.md),
+// an empty path returns the whole document. Arrays are exploded into one value per element.
+func extractValues(value []byte, format, path string) ([]interface{}, error) {
+	doc, err := decodeValue(value, format)
+	if err != nil {
+		return nil, err
+	}
+
+	if path == "" {
+		path = "@this"
+	}
+	result := gjson.GetBytes(doc, path)
+	if !result.Exists() {
+		return nil, fmt.Errorf("path %s not found", path)
+	}
+
+	if !result.IsArray() {
+		return []interface{}{jsonResultValue(result)}, nil
+	}
+
+	values := []interface{}{}
+	for _, element := range result.Array() {
+		values = append(values, jsonResultValue(element))
+	}
+	return values, nil
+}
+
+// jsonResultValue converts a gjson result to a float64, bool or string.
+// Objects and nested arrays are returned as raw JSON string.
+func jsonResultValue(result gjson.Result) interface{} {
+	switch result.Type {
+	case gjson.Number:
+		return result.Num
+	case gjson.True, gjson.False:
+		return result.Bool()
+	case gjson.String:
+		return result.Str
+	case gjson.Null:
+		return nil
+	}
+	return result.Raw
+}
+
+// newFieldFromValues creates a field with the type of the values.
+// If the values have different types, all values are converted to strings.
+// If there are nil values, a nullable field is created.
+func newFieldFromValues(name string, labels data.Labels, values []interface{}) *data.Field {
+	fieldType := data.FieldTypeUnknown
+	nullable := false
+	for _, value := range values {
+		var valueType data.FieldType
+		switch value.(type) {
+		case nil:
+			nullable = true
+			continue
+		case int64:
+			valueType = data.FieldTypeInt64
+		case float64:
+			valueType = data.FieldTypeFloat64
+		case bool:
+			valueType = data.FieldTypeBool
+		case time.Time:
+			valueType = data.FieldTypeTime
+		default:
+			valueType = data.FieldTypeString
+		}
+
+		switch {
+		case fieldType == data.FieldTypeUnknown || fieldType == valueType:
+			fieldType = valueType
+		case isNumeric(fieldType) && isNumeric(valueType):
+			fieldType = data.FieldTypeFloat64
+		default:
+			fieldType = data.FieldTypeString
+		}
+	}
+	if fieldType == data.FieldTypeUnknown {
+		fieldType = data.FieldTypeString
+	}
+	if nullable {
+		fieldType = fieldType.NullableType()
+	}
+
+	field := data.NewFieldFromFieldType(fieldType, len(values))
+	field.Name = name
+	field.Labels = labels
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		field.SetConcrete(i, convertValue(value, fieldType.NonNullableType()))
+	}
+	return field
+}
+
+func isNumeric(fieldType data.FieldType) bool {
+	return fieldType == data.FieldTypeInt64 || fieldType == data.FieldTypeFloat64
+}
+
+// convertValue converts a value to the go type of fieldType
+func convertValue(value interface{}, fieldType data.FieldType) interface{} {
+	switch fieldType {
+	case data.FieldTypeFloat64:
+		if intValue, ok := value.(int64); ok {
+			return float64(intValue)
+		}
+	case data.FieldTypeString:
+		if _, ok := value.(string); !ok {
+			return fmt.Sprint(value)
+		}
+	}
+	return value
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestExtractValues(t *testing.T) {
+	value := []byte(`{"replicas": 3, "enabled": true, "image": "nginx", "ports": [80, 443], "spec": {"strategy": {"type": "RollingUpdate"}}, "env": null}`)
+
+	var tests = []struct {
+		name    string
+		path    string
+		values  []interface{}
+		wantErr bool
+	}{
+		{name: "number", path: "replicas", values: []interface{}{float64(3)}},
+		{name: "boolean", path: "enabled", values: []interface{}{true}},
+		{name: "string", path: "image", values: []interface{}{"nginx"}},
+		{name: "array", path: "ports", values: []interface{}{float64(80), float64(443)}},
+		{name: "nested", path: "spec.strategy.type", values: []interface{}{"RollingUpdate"}},
+		{name: "object", path: "spec.strategy", values: []interface{}{`{"type": "RollingUpdate"}`}},
+		{name: "null", path: "env", values: []interface{}{nil}},
+		{name: "not found", path: "spec.replicas", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := extractValues(value, "json", tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("expected %v, got %v", tt.values, values)
+			}
+		})
+	}
+
+	if _, err := extractValues([]byte("no json"), "json", "replicas"); err == nil {
+		t.Errorf("expected error for invalid JSON")
+	}
+}
+
+func TestExtractValuesWithFormat(t *testing.T) {
+	var tests = []struct {
+		name    string
+		value   string
+		format  string
+		path    string
+		values  []interface{}
+		wantErr bool
+	}{
+		{name: "json", value: `{"spec": {"replicas": 3}}`, format: "json", path: "spec.replicas", values: []interface{}{float64(3)}},
+		{name: "yaml", value: "spec:\n  replicas: 3\n  ports: [80, 443]\n", format: "yaml", path: "spec.ports", values: []interface{}{float64(80), float64(443)}},
+		{name: "toml", value: "[spec]\nreplicas = 3\n", format: "toml", path: "spec.replicas", values: []interface{}{float64(3)}},
+		{name: "hcl", value: "service \"web\" {\n  port = 80\n}\n", format: "hcl", path: "service.web.port", values: []interface{}{float64(80)}},
+		{name: "hcl labeled blocks", value: "service \"web\" {\n  port = 80\n}\nservice \"api\" {\n  port = 81\n}\n", format: "hcl", path: "service.api.port", values: []interface{}{float64(81)}},
+		{name: "hcl unlabeled blocks", value: "rule {\n  port = 80\n}\nrule {\n  port = 81\n}\n", format: "hcl", path: "rule.#.port", values: []interface{}{float64(80), float64(81)}},
+		{name: "base64", value: "eyJyZXBsaWNhcyI6IDN9", format: "base64", path: "replicas", values: []interface{}{float64(3)}},
+		{name: "raw", value: `{"replicas": 3}`, format: "raw", values: []interface{}{`{"replicas": 3}`}},
+		{name: "auto json", value: `{"replicas": 3}`, path: "replicas", values: []interface{}{float64(3)}},
+		{name: "auto yaml", value: "replicas: 3\n", format: "auto", path: "replicas", values: []interface{}{float64(3)}},
+		{name: "auto toml", value: "replicas = 3\n", format: "auto", path: "replicas", values: []interface{}{float64(3)}},
+		{name: "auto hcl", value: "service \"web\" {\n  port = 80\n}\n", format: "auto", path: "service.web.port", values: []interface{}{float64(80)}},
+		{name: "auto string", value: "nginx:1.19", format: "auto", values: []interface{}{"nginx:1.19"}},
+		{name: "auto number", value: "42", format: "auto", values: []interface{}{float64(42)}},
+		{name: "invalid yaml", value: "replicas: [3", format: "yaml", wantErr: true},
+		{name: "invalid base64", value: "{}", format: "base64", wantErr: true},
+		{name: "unknown format", value: "{}", format: "xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := extractValues([]byte(tt.value), tt.format, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("expected %v, got %v", tt.values, values)
+			}
+		})
+	}
+}
+
+func TestNewFieldFromValues(t *testing.T) {
+	var tests = []struct {
+		name      string
+		values    []interface{}
+		fieldType data.FieldType
+	}{
+		{name: "int", values: []interface{}{int64(1), int64(2)}, fieldType: data.FieldTypeInt64},
+		{name: "int and float", values: []interface{}{int64(1), float64(2.5)}, fieldType: data.FieldTypeFloat64},
+		{name: "bool with nil", values: []interface{}{true, nil}, fieldType: data.FieldTypeNullableBool},
+		{name: "int and string", values: []interface{}{int64(1), "Not Found"}, fieldType: data.FieldTypeString},
+		{name: "empty", values: []interface{}{}, fieldType: data.FieldTypeString},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field := newFieldFromValues("values", nil, tt.values)
+			if field.Type() != tt.fieldType {
+				t.Errorf("expected type %s, got %s", tt.fieldType, field.Type())
+			}
+			if field.Len() != len(tt.values) {
+				t.Errorf("expected %d values, got %d", len(tt.values), field.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/hashicorp/consul/api"
+)
+
+// variableItem is a value of a dashboard variable before the regex is applied.
+// name is the string the regex is matched against.
+type variableItem struct {
+	name  string
+	text  string
+	value string
+}
+
+// queryVariable returns the values of a dashboard variable as a frame with a text and a value field.
+// The values are read from the source of the query:
+// keys: the direct subkeys of the target
+// values: the values of all keys below the target
+// services: the services in the catalog
+// nodes: the nodes in the catalog
+// tags: the tags of the target service or of all services
+func queryVariable(ctx context.Context, consul *api.Client, query queryModel, opts *api.QueryOptions) backend.DataResponse {
+	log.DefaultLogger.Debug("queryVariable", "query", query)
+
+	var regex *regexp.Regexp
+	if query.Regex != "" {
+		var err error
+		regex, err = regexp.Compile(query.Regex)
+		if err != nil {
+			return backend.DataResponse{Error: fmt.Errorf("error compiling regex %s: %v", query.Regex, err)}
+		}
+	}
+
+	items, err := getVariableItems(consul, query.VariableSource, strings.Replace(query.Target, "\\.", ".", -1), opts.WithContext(ctx))
+	if err != nil {
+		return backend.DataResponse{Error: err}
+	}
+
+	frame := data.NewFrame("variable",
+		data.NewField("text", nil, []string{}),
+		data.NewField("value", nil, []string{}),
+	)
+	seen := map[string]bool{}
+	for _, item := range items {
+		text, value, ok := applyVariableRegex(regex, item)
+		if !ok || seen[value] {
+			continue
+		}
+		seen[value] = true
+		frame.AppendRow(text, value)
+	}
+	return backend.DataResponse{Frames: []*data.Frame{frame}}
+}
+
+func getVariableItems(consul *api.Client, source, target string, opts *api.QueryOptions) ([]variableItem, error) {
+	var items []variableItem
+	switch source {
+	case "", "keys":
+		if target != "" && !strings.HasSuffix(target, "/") {
+			target += "/"
+		}
+		keys, _, err := consul.KV().Keys(target, "/", opts)
+		if err != nil {
+			return nil, fmt.Errorf("error consul keys %s: %v", target, err)
+		}
+		for _, key := range keys {
+			items = append(items, variableItem{name: key, text: key, value: key})
+		}
+	case "values":
+		kvs, _, err := consul.KV().List(target, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error consul list %s: %v", target, err)
+		}
+		for _, kv := range kvs {
+			items = append(items, variableItem{name: kv.Key, text: string(kv.Value), value: string(kv.Value)})
+		}
+	case "services":
+		services, _, err := consul.Catalog().Services(opts)
+		if err != nil {
+			return nil, fmt.Errorf("error consul catalog services: %v", err)
+		}
+		for _, name := range sortedKeys(services) {
+			items = append(items, variableItem{name: name, text: name, value: name})
+		}
+	case "nodes":
+		nodes, _, err := consul.Catalog().Nodes(opts)
+		if err != nil {
+			return nil, fmt.Errorf("error consul catalog nodes: %v", err)
+		}
+		for _, node := range nodes {
+			items = append(items, variableItem{name: node.Node, text: node.Node, value: node.Node})
+		}
+	case "tags":
+		services, _, err := consul.Catalog().Services(opts)
+		if err != nil {
+			return nil, fmt.Errorf("error consul catalog services: %v", err)
+		}
+		var tags []string
+		for name, serviceTags := range services {
+			if target == "" || name == target {
+				tags = append(tags, serviceTags...)
+			}
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			items = append(items, variableItem{name: tag, text: tag, value: tag})
+		}
+	default:
+		return nil, fmt.Errorf("unknown variable source %s", source)
+	}
+	return items, nil
+}
+
+// applyVariableRegex matches the name of an item against regex like Grafana does for variables.
+// Named groups text and value set the text and the value. Otherwise the first group is used
+// as text and value. Items which don't match are dropped.
+func applyVariableRegex(regex *regexp.Regexp, item variableItem) (string, string, bool) {
+	if regex == nil {
+		return item.text, item.value, true
+	}
+
+	match := regex.FindStringSubmatch(item.name)
+	if match == nil {
+		return "", "", false
+	}
+
+	text, value := item.text, item.value
+	textIdx, valueIdx := subexpIndex(regex, "text"), subexpIndex(regex, "value")
+	switch {
+	case textIdx > 0 || valueIdx > 0:
+		if valueIdx > 0 {
+			value = match[valueIdx]
+			text = value
+		}
+		if textIdx > 0 {
+			text = match[textIdx]
+		}
+	case len(match) > 1:
+		text, value = match[1], match[1]
+	}
+	return text, value, true
+}
+
+func subexpIndex(regex *regexp.Regexp, name string) int {
+	for i, subexpName := range regex.SubexpNames() {
+		if subexpName == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func sortedKeys(m map[string][]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
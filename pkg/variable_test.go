@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestApplyVariableRegex(t *testing.T) {
+	item := variableItem{name: "deployments/web/name", text: "web", value: "web"}
+
+	var tests = []struct {
+		regex         string
+		text, value   string
+		expectedMatch bool
+	}{
+		{regex: "", text: "web", value: "web", expectedMatch: true},
+		{regex: "^deployments/", text: "web", value: "web", expectedMatch: true},
+		{regex: "^registry/", expectedMatch: false},
+		{regex: "^deployments/([^/]+)/", text: "web", value: "web", expectedMatch: true},
+		{regex: "^(?P<value>[^/]+)/(?P<text>[^/]+)/", text: "web", value: "deployments", expectedMatch: true},
+		{regex: "^(?P<value>[^/]+)/", text: "deployments", value: "deployments", expectedMatch: true},
+		{regex: "/(?P<text>[^/]+)$", text: "name", value: "web", expectedMatch: true},
+	}
+
+	for _, tt := range tests {
+		var regex *regexp.Regexp
+		if tt.regex != "" {
+			regex = regexp.MustCompile(tt.regex)
+		}
+		text, value, ok := applyVariableRegex(regex, item)
+		if ok != tt.expectedMatch || text != tt.text || value != tt.value {
+			t.Errorf("regex %q: expected (%q, %q, %v), got (%q, %q, %v)", tt.regex, tt.text, tt.value, tt.expectedMatch, text, value, ok)
+		}
+	}
+}
+
+func TestQueryVariable(t *testing.T) {
+	srv, consul := setupTestServer(t)
+	defer srv.Stop()
+
+	instance, err := newInstanceSettings(consul, jsonData{})
+	if err != nil {
+		t.Fatalf("could not create instance: %v", err)
+	}
+
+	var tests = []struct {
+		name           string
+		query          queryModel
+		expectedTexts  []string
+		expectedValues []string
+	}{
+		{
+			name:           "keys",
+			query:          queryModel{Type: "variable", Target: "deployments"},
+			expectedTexts:  []string{"deployments/api/", "deployments/web/"},
+			expectedValues: []string{"deployments/api/", "deployments/web/"},
+		},
+		{
+			name:           "keys with capture group",
+			query:          queryModel{Type: "variable", VariableSource: "keys", Target: "deployments/", Regex: "deployments/([^/]+)/"},
+			expectedTexts:  []string{"api", "web"},
+			expectedValues: []string{"api", "web"},
+		},
+		{
+			name:           "values",
+			query:          queryModel{Type: "variable", VariableSource: "values", Target: "deployments/", Regex: "/name$"},
+			expectedTexts:  []string{"api", "web"},
+			expectedValues: []string{"api", "web"},
+		},
+		{
+			name:           "values with named groups",
+			query:          queryModel{Type: "variable", VariableSource: "values", Target: "deployments/", Regex: "deployments/(?P<text>[^/]+)/(?P<value>name)$"},
+			expectedTexts:  []string{"api"},
+			expectedValues: []string{"name"},
+		},
+		{
+			name:           "services",
+			query:          queryModel{Type: "variable", VariableSource: "services"},
+			expectedTexts:  []string{"consul"},
+			expectedValues: []string{"consul"},
+		},
+		{
+			name:           "tags of unknown service",
+			query:          queryModel{Type: "variable", VariableSource: "tags", Target: "unknown"},
+			expectedTexts:  nil,
+			expectedValues: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := queryVariable(context.TODO(), consul, tt.query, instance.queryOptions(tt.query))
+			if res.Error != nil {
+				t.Fatalf("unexpected error: %v", res.Error)
+			}
+			var texts, values []string
+			for i := 0; i < res.Frames[0].Rows(); i++ {
+				texts = append(texts, res.Frames[0].Fields[0].At(i).(string))
+				values = append(values, res.Frames[0].Fields[1].At(i).(string))
+			}
+			if !reflect.DeepEqual(texts, tt.expectedTexts) || !reflect.DeepEqual(values, tt.expectedValues) {
+				t.Errorf("expected texts %v and values %v, got texts %v and values %v", tt.expectedTexts, tt.expectedValues, texts, values)
+			}
+		})
+	}
+
+	t.Run("nodes", func(t *testing.T) {
+		res := queryVariable(context.TODO(), consul, queryModel{Type: "variable", VariableSource: "nodes"}, instance.queryOptions(queryModel{}))
+		if res.Error != nil || res.Frames[0].Rows() != 1 {
+			t.Errorf("expected one node, got error %v", res.Error)
+		}
+	})
+
+	t.Run("invalid regex", func(t *testing.T) {
+		res := queryVariable(context.TODO(), consul, queryModel{Type: "variable", Regex: "("}, instance.queryOptions(queryModel{}))
+		if res.Error == nil {
+			t.Errorf("expected error")
+		}
+	})
+}
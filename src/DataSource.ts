@@ -1,11 +1,12 @@
 import { DataSourceWithBackend, getBackendSrv, getTemplateSrv, toDataQueryResponse } from '@grafana/runtime';
-import { MyDataSourceOptions, ConsulQuery } from './types';
+import { MyDataSourceOptions, ConsulQuery, ResourceList, ResourceValue, ScopedVariable } from './types';
 import {
   DataQueryRequest,
   DataQueryResponse,
   DataSourceInstanceSettings,
   LoadingState,
   MetricFindValue,
+  ScopedVars,
 } from '@grafana/data';
 
 import { Observable } from 'rxjs';
@@ -19,21 +20,21 @@ export class DataSource extends DataSourceWithBackend<ConsulQuery, MyDataSourceO
   }
 
   query(options: DataQueryRequest<ConsulQuery>): Observable<DataQueryResponse> {
-    for (const target of options.targets) {
-      target.target = getTemplateSrv().replace(target.target, options.scopedVars);
-    }
+    // variables are interpolated by the backend, the targets are copied so the values are not saved with the panel
+    const scopedVars = this.getScopedVars(options.scopedVars);
+    const request = { ...options, targets: options.targets.map(target => ({ ...target, scopedVars })) };
 
     // store the targets in activeTargets so we can
     // access the legendFormat later on via the refId
     let activeTargets: { [key: string]: any } = {};
-    for (const target of options.targets) {
+    for (const target of request.targets) {
       if (target.hide) {
         continue;
       }
       activeTargets[target.refId] = target;
     }
 
-    return super.query(options).pipe(
+    return super.query(request).pipe(
       map((rsp: DataQueryResponse) => {
         const finalRsp: DataQueryResponse = { data: [], state: LoadingState.Done };
 
@@ -54,6 +55,26 @@ export class DataSource extends DataSourceWithBackend<ConsulQuery, MyDataSourceO
     );
   }
 
+  /**
+   * Returns the current values of the dashboard variables, overridden by the scoped variables of the request.
+   * Multi-value variables are sent as list, all value is resolved to the selected values.
+   */
+  getScopedVars(scopedVars: ScopedVars): Record<string, ScopedVariable> {
+    const templateSrv = getTemplateSrv();
+    const vars: Record<string, ScopedVariable> = {};
+    for (const variable of templateSrv.getVariables()) {
+      try {
+        vars[variable.name] = { value: JSON.parse(templateSrv.replace(`\${${variable.name}:json}`, scopedVars)) };
+      } catch (e) {
+        vars[variable.name] = { value: templateSrv.replace(`\${${variable.name}}`, scopedVars) };
+      }
+    }
+    for (const name of Object.keys(scopedVars || {})) {
+      vars[name] = { value: scopedVars[name].value };
+    }
+    return vars;
+  }
+
   renderTemplate(aliasPattern: string, aliasData: string) {
     const aliasRegex = /{{\s*(.+?)\s*}}/g;
     return aliasPattern.replace(aliasRegex, function(match, g1) {
@@ -64,7 +85,33 @@ export class DataSource extends DataSourceWithBackend<ConsulQuery, MyDataSourceO
     });
   }
 
+  getKeys(prefix: string, after?: string): Promise<ResourceList> {
+    return this.getResource('keys', { prefix, after });
+  }
+
+  getServices(prefix?: string): Promise<ResourceList> {
+    return this.getResource('services', { prefix });
+  }
+
+  getNodes(prefix?: string): Promise<ResourceList> {
+    return this.getResource('nodes', { prefix });
+  }
+
+  getDatacenters(): Promise<ResourceList> {
+    return this.getResource('datacenters');
+  }
+
+  getValue(key: string): Promise<ResourceValue> {
+    return this.getResource('value', { key });
+  }
+
+  /**
+   * Queries the values of a dashboard variable. The query is either a key prefix, whose direct subkeys are returned,
+   * or source(target) or source(target, /regex/) with the sources keys, values, services, nodes and tags.
+   */
   metricFindQuery(query: string): Promise<MetricFindValue[]> {
+    const variableQuery = parseVariableQuery(getTemplateSrv().replace(query));
+
     return getBackendSrv()
       .fetch({
         url: '/api/tsdb/query',
@@ -72,10 +119,9 @@ export class DataSource extends DataSourceWithBackend<ConsulQuery, MyDataSourceO
         data: {
           queries: [
             {
-              target: query,
-              format: 'timeseries',
-              type: 'keys',
-              refId: 'keys',
+              ...variableQuery,
+              type: 'variable',
+              refId: 'variable',
               datasourceId: this.id,
             },
           ],
@@ -87,10 +133,27 @@ export class DataSource extends DataSourceWithBackend<ConsulQuery, MyDataSourceO
 
         let values: MetricFindValue[] = [];
         resp.data.forEach((data: DataQueryResponseData) => {
-          values.push({ text: data.name, expandable: false });
+          const texts = data.fields[0].values;
+          const vals = data.fields[1].values;
+          for (let i = 0; i < vals.length; i++) {
+            values.push({ text: texts.get(i), value: vals.get(i), expandable: false } as MetricFindValue);
+          }
         });
 
         return values;
       });
   }
 }
+
+const variableQueryRegex = /^\s*(keys|values|services|nodes|tags)\(\s*([^,]*?)\s*(?:,\s*\/(.*)\/\s*)?\)\s*$/;
+
+/**
+ * Parses source(target) and source(target, /regex/), everything else is a key prefix
+ */
+export function parseVariableQuery(query: string): Partial<ConsulQuery> {
+  const match = variableQueryRegex.exec(query);
+  if (!match) {
+    return { target: query.trim(), variableSource: 'keys' };
+  }
+  return { variableSource: match[1], target: match[2], regex: match[3] };
+}
@@ -1,14 +1,59 @@
 import React, { PureComponent } from 'react';
-import { InlineFormLabel, Select } from '@grafana/ui';
+import { InlineFormLabel, InlineSwitch, Select } from '@grafana/ui';
 import { QueryEditorProps, SelectableValue } from '@grafana/data';
 import { DataSource } from './DataSource';
-import { ConsulQuery, MyDataSourceOptions } from './types';
+import { ConsulQuery, MyDataSourceOptions, ResourceList } from './types';
 
 type Props = QueryEditorProps<DataSource, ConsulQuery, MyDataSourceOptions>;
 
 const FORMAT_OPTIONS: Array<SelectableValue<string>> = [
   { label: 'Time series', value: 'timeseries' },
   { label: 'Table', value: 'table' },
+  { label: 'Node graph', value: 'nodegraph' },
+];
+
+const CATALOG_TYPE_OPTIONS: Array<SelectableValue<string>> = [
+  { label: 'list services', value: 'services' },
+  { label: 'list nodes', value: 'nodes' },
+  { label: 'list service instances', value: 'service' },
+];
+
+const HEALTH_TYPE_OPTION: SelectableValue<string> = { label: 'get health checks', value: 'health' };
+
+const SESSION_TYPE_OPTIONS: Array<SelectableValue<string>> = [
+  { label: 'list sessions and locks', value: 'sessions' },
+  { label: 'get session and locks', value: 'session' },
+];
+
+const MEMBERS_TYPE_OPTION: SelectableValue<string> = { label: 'list agent members', value: 'members' };
+
+const OPERATOR_TYPE_OPTIONS: Array<SelectableValue<string>> = [
+  { label: 'list raft peers', value: 'raft' },
+  { label: 'get autopilot health', value: 'autopilot' },
+];
+
+const NODE_GRAPH_TYPE_OPTIONS: Array<SelectableValue<string>> = [
+  { label: 'list intentions', value: 'intentions' },
+  { label: 'get service topology', value: 'topology' },
+];
+
+const CONNECT_TYPE_OPTIONS: Array<SelectableValue<string>> = [
+  ...NODE_GRAPH_TYPE_OPTIONS,
+  { label: 'list CA roots', value: 'caroots' },
+];
+
+const CONFIG_ENTRIES_TYPE_OPTION: SelectableValue<string> = { label: 'list config entries', value: 'configentries' };
+
+const PREPARED_QUERY_TYPE_OPTIONS: Array<SelectableValue<string>> = [
+  { label: 'list prepared queries', value: 'preparedqueries' },
+  { label: 'execute prepared query', value: 'preparedquery' },
+];
+
+const ACL_TYPE_OPTIONS: Array<SelectableValue<string>> = [
+  { label: 'list ACL tokens', value: 'acltokens' },
+  { label: 'list ACL policies', value: 'aclpolicies' },
+  { label: 'list ACL roles', value: 'aclroles' },
+  { label: 'list ACL auth methods', value: 'aclauthmethods' },
 ];
 
 const TYPE_OPTIONS: Array<SelectableValue<string>> = [
@@ -16,14 +61,119 @@ const TYPE_OPTIONS: Array<SelectableValue<string>> = [
   { label: 'get direct subkeys', value: 'keys' },
   { label: 'get subkeys as tags', value: 'tags' },
   { label: 'get subkeys recursive as tags', value: 'tagsrec' },
+  ...CATALOG_TYPE_OPTIONS,
+  HEALTH_TYPE_OPTION,
+  ...SESSION_TYPE_OPTIONS,
+  MEMBERS_TYPE_OPTION,
+  ...OPERATOR_TYPE_OPTIONS,
+  ...CONNECT_TYPE_OPTIONS,
+  CONFIG_ENTRIES_TYPE_OPTION,
+  ...PREPARED_QUERY_TYPE_OPTIONS,
+  ...ACL_TYPE_OPTIONS,
 ];
 
+const TABLE_TYPE_OPTIONS: Array<SelectableValue<string>> = [
+  { label: 'get keys as rows', value: 'get' },
+  ...CATALOG_TYPE_OPTIONS,
+  HEALTH_TYPE_OPTION,
+  ...SESSION_TYPE_OPTIONS,
+  MEMBERS_TYPE_OPTION,
+  ...OPERATOR_TYPE_OPTIONS,
+  ...CONNECT_TYPE_OPTIONS,
+  CONFIG_ENTRIES_TYPE_OPTION,
+  ...PREPARED_QUERY_TYPE_OPTIONS,
+  ...ACL_TYPE_OPTIONS,
+];
+
+const HEALTH_FILTER_OPTIONS: Array<SelectableValue<string>> = [
+  { label: 'all checks', value: '' },
+  { label: 'by service', value: 'service' },
+  { label: 'by node', value: 'node' },
+  { label: 'by check ID', value: 'check' },
+];
+
+const POOL_OPTIONS: Array<SelectableValue<string>> = [
+  { label: 'LAN', value: 'lan' },
+  { label: 'WAN', value: 'wan' },
+];
+
+const KIND_OPTIONS: Array<SelectableValue<string>> = [
+  { label: 'all kinds', value: '' },
+  { label: 'service-defaults', value: 'service-defaults' },
+  { label: 'proxy-defaults', value: 'proxy-defaults' },
+  { label: 'service-router', value: 'service-router' },
+  { label: 'service-splitter', value: 'service-splitter' },
+  { label: 'service-resolver', value: 'service-resolver' },
+  { label: 'ingress-gateway', value: 'ingress-gateway' },
+  { label: 'terminating-gateway', value: 'terminating-gateway' },
+];
+
+const VALUE_FORMAT_OPTIONS: Array<SelectableValue<string>> = [
+  { label: 'number', value: '' },
+  { label: 'auto-detect', value: 'auto' },
+  { label: 'JSON', value: 'json' },
+  { label: 'YAML', value: 'yaml' },
+  { label: 'HCL', value: 'hcl' },
+  { label: 'TOML', value: 'toml' },
+  { label: 'base64', value: 'base64' },
+  { label: 'raw', value: 'raw' },
+];
+
+const SERIES_FORMAT_OPTIONS: Array<SelectableValue<string>> = [
+  { label: 'wide', value: 'wide' },
+  { label: 'long', value: 'long' },
+];
+
+const isCatalogType = (type?: string) => CATALOG_TYPE_OPTIONS.some(option => option.value === type);
+
+const isSessionType = (type?: string) => SESSION_TYPE_OPTIONS.some(option => option.value === type);
+
+const isOperatorType = (type?: string) => OPERATOR_TYPE_OPTIONS.some(option => option.value === type);
+
+const isConnectType = (type?: string) => CONNECT_TYPE_OPTIONS.some(option => option.value === type);
+
+const isPreparedQueryType = (type?: string) => PREPARED_QUERY_TYPE_OPTIONS.some(option => option.value === type);
+
+const isACLType = (type?: string) => ACL_TYPE_OPTIONS.some(option => option.value === type);
+
+// isKVType returns true for the query types which query the key value store
+const isKVType = (type?: string) =>
+  !isCatalogType(type) &&
+  type !== 'health' &&
+  !isSessionType(type) &&
+  type !== 'members' &&
+  !isOperatorType(type) &&
+  !isConnectType(type) &&
+  type !== 'configentries' &&
+  !isPreparedQueryType(type) &&
+  !isACLType(type);
+
 interface State {
   target: string;
   formatOption: SelectableValue<string>;
   typeOption: SelectableValue<string>;
   legendFormat?: string;
   columns?: string;
+  live?: boolean;
+  datacenter?: string;
+  namespace?: string;
+  partition?: string;
+  tag?: string;
+  nodeMeta?: string;
+  healthFilterOption: SelectableValue<string>;
+  lockPrefix?: string;
+  expiresWithin?: string;
+  poolOption: SelectableValue<string>;
+  kindOption: SelectableValue<string>;
+  path?: string;
+  valueFormatOption: SelectableValue<string>;
+  metadata?: boolean;
+  history?: boolean;
+  alerting?: boolean;
+  seriesFormatOption: SelectableValue<string>;
+  valueMappings?: string;
+  suggestions: string[];
+  preview?: string;
 }
 
 export class QueryEditor extends PureComponent<Props, State> {
@@ -38,6 +188,24 @@ export class QueryEditor extends PureComponent<Props, State> {
       type: 'get',
       legendFormat: '',
       columns: '',
+      live: false,
+      datacenter: '',
+      namespace: '',
+      partition: '',
+      tag: '',
+      nodeMeta: '',
+      healthFilter: '',
+      lockPrefix: '',
+      expiresWithin: '',
+      pool: 'lan',
+      kind: '',
+      path: '',
+      valueFormat: '',
+      metadata: false,
+      history: false,
+      alerting: false,
+      seriesFormat: 'wide',
+      valueMappings: '',
     };
     const query = Object.assign({}, defaultQuery, props.query);
     this.query = query;
@@ -52,22 +220,109 @@ export class QueryEditor extends PureComponent<Props, State> {
       typeOption: TYPE_OPTIONS.find(option => option.value === query.type) || TYPE_OPTIONS[0],
 
       columns: query.columns,
+
+      live: query.live,
+
+      datacenter: query.datacenter,
+      namespace: query.namespace,
+      partition: query.partition,
+      tag: query.tag,
+      nodeMeta: query.nodeMeta,
+      // Select options
+      healthFilterOption:
+        HEALTH_FILTER_OPTIONS.find(option => option.value === query.healthFilter) || HEALTH_FILTER_OPTIONS[0],
+
+      lockPrefix: query.lockPrefix,
+      expiresWithin: query.expiresWithin,
+      // Select options
+      poolOption: POOL_OPTIONS.find(option => option.value === query.pool) || POOL_OPTIONS[0],
+      kindOption: KIND_OPTIONS.find(option => option.value === query.kind) || KIND_OPTIONS[0],
+
+      path: query.path,
+      // Select options
+      valueFormatOption:
+        VALUE_FORMAT_OPTIONS.find(option => option.value === query.valueFormat) || VALUE_FORMAT_OPTIONS[0],
+
+      metadata: query.metadata,
+      history: query.history,
+      alerting: query.alerting,
+      // Select options
+      seriesFormatOption:
+        SERIES_FORMAT_OPTIONS.find(option => option.value === query.seriesFormat) || SERIES_FORMAT_OPTIONS[0],
+      valueMappings: query.valueMappings,
+
+      suggestions: [],
     };
   }
 
+  // updateSuggestions loads the keys, services or nodes matching the target for autocompletion
+  updateSuggestions = (target: string) => {
+    const { datasource } = this.props;
+    const type = this.state.typeOption.value;
+
+    let suggestions: Promise<ResourceList>;
+    if (
+      type === 'service' ||
+      type === 'intentions' ||
+      (type === 'health' && this.state.healthFilterOption.value === 'service')
+    ) {
+      suggestions = datasource.getServices(target);
+    } else if ((type === 'health' && this.state.healthFilterOption.value === 'node') || type === 'sessions') {
+      suggestions = datasource.getNodes(target);
+    } else if (isKVType(type)) {
+      suggestions = datasource.getKeys(target.substring(0, target.lastIndexOf('/') + 1));
+    } else {
+      return;
+    }
+    suggestions.then(list => this.setState({ suggestions: list.items })).catch(() => this.setState({ suggestions: [] }));
+  };
+
+  // updatePreview loads the value of the target of get queries
+  updatePreview = () => {
+    const { datasource } = this.props;
+    const { target, typeOption, formatOption } = this.state;
+    if (formatOption.value !== 'timeseries' || typeOption.value !== 'get' || !target) {
+      this.setState({ preview: undefined });
+      return;
+    }
+    datasource
+      .getValue(target.replace(/\\\./g, '.').replace(/\/$/, ''))
+      .then(value => this.setState({ preview: value.truncated ? value.value + '...' : value.value }))
+      .catch(() => this.setState({ preview: undefined }));
+  };
+
+  componentDidMount() {
+    this.updatePreview();
+  }
+
   onTargetChanged = (e: React.SyntheticEvent<HTMLInputElement>) => {
     const target = e.currentTarget.value;
     this.query.target = target;
     this.setState({ target: target }, this.onRunQuery);
+    this.updateSuggestions(target);
   };
 
   onFormatChange = (option: SelectableValue<string>) => {
     this.query.format = option.value;
+    if (option.value === 'nodegraph' && !NODE_GRAPH_TYPE_OPTIONS.some(type => type.value === this.query.type)) {
+      // node graphs are only supported by intentions and topology queries
+      this.query.type = NODE_GRAPH_TYPE_OPTIONS[0].value;
+      this.setState({ formatOption: option, typeOption: NODE_GRAPH_TYPE_OPTIONS[0] }, this.onRunQuery);
+      return;
+    }
     this.setState({ formatOption: option }, this.onRunQuery);
   };
 
   onTypeChange = (option: SelectableValue<string>) => {
     this.query.type = option.value;
+    if (option.value === 'members') {
+      // members are always returned by the agent of the data source
+      this.query.datacenter = '';
+      this.query.namespace = '';
+      this.query.partition = '';
+      this.setState({ typeOption: option, datacenter: '', namespace: '', partition: '' }, this.onRunQuery);
+      return;
+    }
     this.setState({ typeOption: option }, this.onRunQuery);
   };
 
@@ -83,6 +338,114 @@ export class QueryEditor extends PureComponent<Props, State> {
     this.setState({ columns }, this.onRunQuery);
   };
 
+  onLiveChange = (e: React.SyntheticEvent<HTMLInputElement>) => {
+    const live = e.currentTarget.checked;
+    this.query.live = live;
+    this.setState({ live }, this.onRunQuery);
+  };
+
+  onDatacenterChange = (e: React.SyntheticEvent<HTMLInputElement>) => {
+    const datacenter = e.currentTarget.value;
+    this.query.datacenter = datacenter;
+    this.setState({ datacenter }, this.onRunQuery);
+  };
+
+  onNamespaceChange = (e: React.SyntheticEvent<HTMLInputElement>) => {
+    const namespace = e.currentTarget.value;
+    this.query.namespace = namespace;
+    this.setState({ namespace }, this.onRunQuery);
+  };
+
+  onPartitionChange = (e: React.SyntheticEvent<HTMLInputElement>) => {
+    const partition = e.currentTarget.value;
+    this.query.partition = partition;
+    this.setState({ partition }, this.onRunQuery);
+  };
+
+  onTagChange = (e: React.SyntheticEvent<HTMLInputElement>) => {
+    const tag = e.currentTarget.value;
+    this.query.tag = tag;
+    this.setState({ tag }, this.onRunQuery);
+  };
+
+  onNodeMetaChange = (e: React.SyntheticEvent<HTMLInputElement>) => {
+    const nodeMeta = e.currentTarget.value;
+    this.query.nodeMeta = nodeMeta;
+    this.setState({ nodeMeta }, this.onRunQuery);
+  };
+
+  onHealthFilterChange = (option: SelectableValue<string>) => {
+    this.query.healthFilter = option.value;
+    this.setState({ healthFilterOption: option }, this.onRunQuery);
+  };
+
+  onPoolChange = (option: SelectableValue<string>) => {
+    this.query.pool = option.value;
+    this.setState({ poolOption: option }, this.onRunQuery);
+  };
+
+  onKindChange = (option: SelectableValue<string>) => {
+    this.query.kind = option.value;
+    this.setState({ kindOption: option }, this.onRunQuery);
+  };
+
+  onLockPrefixChange = (e: React.SyntheticEvent<HTMLInputElement>) => {
+    const lockPrefix = e.currentTarget.value;
+    this.query.lockPrefix = lockPrefix;
+    this.setState({ lockPrefix });
+  };
+
+  onExpiresWithinChange = (e: React.SyntheticEvent<HTMLInputElement>) => {
+    const expiresWithin = e.currentTarget.value;
+    this.query.expiresWithin = expiresWithin;
+    this.setState({ expiresWithin });
+  };
+
+  onPathChange = (e: React.SyntheticEvent<HTMLInputElement>) => {
+    const path = e.currentTarget.value;
+    this.query.path = path;
+    this.setState({ path }, this.onRunQuery);
+  };
+
+  onValueFormatChange = (option: SelectableValue<string>) => {
+    this.query.valueFormat = option.value;
+    this.setState({ valueFormatOption: option }, this.onRunQuery);
+  };
+
+  onMetadataChange = (e: React.SyntheticEvent<HTMLInputElement>) => {
+    const metadata = e.currentTarget.checked;
+    this.query.metadata = metadata;
+    this.setState({ metadata }, this.onRunQuery);
+  };
+
+  onHistoryChange = (e: React.SyntheticEvent<HTMLInputElement>) => {
+    const history = e.currentTarget.checked;
+    this.query.history = history;
+    this.setState({ history }, this.onRunQuery);
+  };
+
+  onAlertingChange = (e: React.SyntheticEvent<HTMLInputElement>) => {
+    const alerting = e.currentTarget.checked;
+    this.query.alerting = alerting;
+    this.setState({ alerting }, this.onRunQuery);
+  };
+
+  onSeriesFormatChange = (option: SelectableValue<string>) => {
+    this.query.seriesFormat = option.value;
+    this.setState({ seriesFormatOption: option }, this.onRunQuery);
+  };
+
+  onValueMappingsChange = (e: React.SyntheticEvent<HTMLInputElement>) => {
+    const valueMappings = e.currentTarget.value;
+    this.query.valueMappings = valueMappings;
+    this.setState({ valueMappings });
+  };
+
+  onTargetBlur = () => {
+    this.onRunQuery();
+    this.updatePreview();
+  };
+
   onRunQuery = () => {
     const { query } = this;
     this.props.onChange(query);
@@ -90,7 +453,39 @@ export class QueryEditor extends PureComponent<Props, State> {
   };
 
   render() {
-    const { target, formatOption, typeOption, legendFormat, columns } = this.state;
+    const {
+      target,
+      formatOption,
+      typeOption,
+      legendFormat,
+      columns,
+      live,
+      datacenter,
+      namespace,
+      partition,
+      tag,
+      nodeMeta,
+      healthFilterOption,
+      lockPrefix,
+      expiresWithin,
+      poolOption,
+      kindOption,
+      path,
+      valueFormatOption,
+      metadata,
+      history,
+      alerting,
+      seriesFormatOption,
+      valueMappings,
+      suggestions,
+      preview,
+    } = this.state;
+    const catalog = isCatalogType(typeOption.value);
+    const health = typeOption.value === 'health';
+    const session = isSessionType(typeOption.value);
+    const members = typeOption.value === 'members';
+    const configEntries = typeOption.value === 'configentries';
+    const kv = isKVType(typeOption.value);
 
     return (
       <div>
@@ -98,13 +493,48 @@ export class QueryEditor extends PureComponent<Props, State> {
           <input
             type="text"
             className="gf-form-input"
-            placeholder="query"
+            placeholder={
+              typeOption.value === 'service'
+                ? 'service name'
+                : health
+                ? 'service, node or check ID'
+                : typeOption.value === 'sessions'
+                ? 'node (optional)'
+                : typeOption.value === 'session'
+                ? 'session ID'
+                : members
+                ? 'segment (optional)'
+                : typeOption.value === 'intentions'
+                ? 'service (optional)'
+                : configEntries
+                ? 'name (optional)'
+                : typeOption.value === 'preparedquery'
+                ? 'prepared query name or ID'
+                : typeOption.value === 'acltokens'
+                ? 'policy (optional)'
+                : 'query'
+            }
             value={target}
+            list={`consul-suggestions-${this.query.refId}`}
             onChange={this.onTargetChanged}
-            onBlur={this.onRunQuery}
+            onBlur={this.onTargetBlur}
           />
+          <datalist id={`consul-suggestions-${this.query.refId}`}>
+            {suggestions.map(suggestion => (
+              <option key={suggestion} value={suggestion} />
+            ))}
+          </datalist>
         </div>
 
+        {preview !== undefined ? (
+          <div className="gf-form">
+            <InlineFormLabel width={7} tooltip="Current value of the key in Consul">
+              Value
+            </InlineFormLabel>
+            <pre className="gf-form-pre">{preview}</pre>
+          </div>
+        ) : null}
+
         <div className="gf-form-inline">
           <div className="gf-form-label width-7">Format</div>
           <Select
@@ -128,7 +558,35 @@ export class QueryEditor extends PureComponent<Props, State> {
             </div>
           ) : null}
 
-          {formatOption.value === 'timeseries' ? (
+          {formatOption.value === 'table' ? (
+            <div className="gf-form">
+              <div className="gf-form-label width-7">Type</div>
+              <Select
+                width={40}
+                isSearchable={false}
+                options={TABLE_TYPE_OPTIONS}
+                onChange={this.onTypeChange}
+                value={TABLE_TYPE_OPTIONS.find(option => option.value === typeOption.value) || TABLE_TYPE_OPTIONS[0]}
+              />
+            </div>
+          ) : null}
+
+          {formatOption.value === 'nodegraph' ? (
+            <div className="gf-form">
+              <div className="gf-form-label width-7">Type</div>
+              <Select
+                width={40}
+                isSearchable={false}
+                options={NODE_GRAPH_TYPE_OPTIONS}
+                onChange={this.onTypeChange}
+                value={
+                  NODE_GRAPH_TYPE_OPTIONS.find(option => option.value === typeOption.value) || NODE_GRAPH_TYPE_OPTIONS[0]
+                }
+              />
+            </div>
+          ) : null}
+
+          {formatOption.value === 'timeseries' && !catalog ? (
             <div className="gf-form">
               <InlineFormLabel
                 width={7}
@@ -148,9 +606,82 @@ export class QueryEditor extends PureComponent<Props, State> {
             </div>
           ) : null}
 
-          {formatOption.value === 'table' ? (
+          {(formatOption.value === 'timeseries' && typeOption.value === 'get') || (formatOption.value === 'table' && kv) ? (
+            <div className="gf-form">
+              <InlineFormLabel
+                width={7}
+                tooltip="Format of the values. Structured values are decoded, so fields can be selected via a path. Without a path and format, values are parsed as numbers."
+              >
+                Value format
+              </InlineFormLabel>
+              <Select
+                width={16}
+                isSearchable={false}
+                options={VALUE_FORMAT_OPTIONS}
+                onChange={this.onValueFormatChange}
+                value={valueFormatOption}
+              />
+            </div>
+          ) : null}
+
+          {formatOption.value === 'timeseries' && typeOption.value === 'get' ? (
             <div className="gf-form">
-              <InlineFormLabel width={7} tooltip="Comma-separated list of Consul keys which should be used as columns.">
+              <InlineFormLabel
+                width={5}
+                tooltip="Path to a field of a JSON, YAML, HCL or TOML value, e.g. spec.replicas. Arrays result in one row per element. Leave empty for numeric values."
+              >
+                Path
+              </InlineFormLabel>
+              <input
+                type="text"
+                className="gf-form-input"
+                placeholder=""
+                value={path}
+                onChange={this.onPathChange}
+                onBlur={this.onRunQuery}
+              />
+            </div>
+          ) : null}
+
+          {formatOption.value === 'timeseries' && kv ? (
+            <div className="gf-form">
+              <InlineFormLabel
+                width={5}
+                tooltip="Updates the panel via Grafana Live as soon as the value changes in Consul. Supported for the types get value and get subkeys as tags."
+              >
+                Live
+              </InlineFormLabel>
+              <InlineSwitch value={live} onChange={this.onLiveChange} />
+            </div>
+          ) : null}
+
+          {formatOption.value === 'timeseries' && typeOption.value === 'get' ? (
+            <div className="gf-form">
+              <InlineFormLabel
+                width={5}
+                tooltip="Shows the values recorded in the time range of the dashboard instead of the current value. The key has to be recorded by the history recorder of the data source, other datacenters and namespaces are not recorded."
+              >
+                History
+              </InlineFormLabel>
+              <InlineSwitch value={history} onChange={this.onHistoryChange} />
+            </div>
+          ) : null}
+
+          {(formatOption.value === 'timeseries' && typeOption.value === 'get') || (formatOption.value === 'table' && kv) ? (
+            <div className="gf-form">
+              <InlineFormLabel
+                width={7}
+                tooltip="Adds the fields createIndex, modifyIndex, lockIndex, flags and session of the keys. In tables, the metadata of column keys can be selected with @, e.g. ../config@modifyIndex."
+              >
+                Metadata
+              </InlineFormLabel>
+              <InlineSwitch value={metadata} onChange={this.onMetadataChange} />
+            </div>
+          ) : null}
+
+          {formatOption.value === 'table' && kv ? (
+            <div className="gf-form">
+              <InlineFormLabel width={7} tooltip="Comma-separated list of Consul keys which should be used as columns. A path to a field of a structured value can be appended with #, e.g. ../config#spec.replicas. Metadata of a key can be selected with @, e.g. ../config@modifyIndex or .@session.">
                 Columns
               </InlineFormLabel>
               <input
@@ -164,6 +695,213 @@ export class QueryEditor extends PureComponent<Props, State> {
             </div>
           ) : null}
         </div>
+
+        {formatOption.value === 'timeseries' && kv ? (
+          <div className="gf-form-inline">
+            <div className="gf-form">
+              <InlineFormLabel
+                width={7}
+                tooltip="Returns numeric series labeled with their key, so alert rules can evaluate them. Get and tags return the values of the keys, keys returns 1 for every subkey."
+              >
+                Alerting
+              </InlineFormLabel>
+              <InlineSwitch value={alerting} onChange={this.onAlertingChange} />
+            </div>
+            {alerting ? (
+              <div className="gf-form">
+                <InlineFormLabel width={7} tooltip="Wide returns a number field per series, long a row per series.">
+                  Series
+                </InlineFormLabel>
+                <Select
+                  width={16}
+                  isSearchable={false}
+                  options={SERIES_FORMAT_OPTIONS}
+                  onChange={this.onSeriesFormatChange}
+                  value={seriesFormatOption}
+                />
+              </div>
+            ) : null}
+            {alerting ? (
+              <div className="gf-form">
+                <InlineFormLabel
+                  width={9}
+                  tooltip="Comma-separated mappings of values to numbers, e.g. passing=0,warning=1,critical=2. Values which are not numeric and have no mapping result in an error."
+                >
+                  Value mappings
+                </InlineFormLabel>
+                <input
+                  type="text"
+                  className="gf-form-input"
+                  placeholder="passing=0,warning=1,critical=2"
+                  value={valueMappings}
+                  onChange={this.onValueMappingsChange}
+                  onBlur={this.onRunQuery}
+                />
+              </div>
+            ) : null}
+          </div>
+        ) : null}
+
+        <div className="gf-form-inline">
+          {health ? (
+            <div className="gf-form">
+              <div className="gf-form-label width-7">Checks</div>
+              <Select
+                width={16}
+                isSearchable={false}
+                options={HEALTH_FILTER_OPTIONS}
+                onChange={this.onHealthFilterChange}
+                value={healthFilterOption}
+              />
+            </div>
+          ) : null}
+          {session ? (
+            <div className="gf-form">
+              <InlineFormLabel
+                width={7}
+                tooltip="Prefix of the keys which are searched for locks of the sessions, e.g. locks/. Locks are not searched if empty, because this would read all keys."
+              >
+                Lock prefix
+              </InlineFormLabel>
+              <input
+                type="text"
+                className="gf-form-input"
+                placeholder="locks/"
+                value={lockPrefix}
+                onChange={this.onLockPrefixChange}
+                onBlur={this.onRunQuery}
+              />
+            </div>
+          ) : null}
+          {typeOption.value === 'acltokens' ? (
+            <div className="gf-form">
+              <InlineFormLabel
+                width={7}
+                tooltip="Only tokens expiring within this duration are returned, e.g. 720h for 30 days. All tokens are returned if empty."
+              >
+                Expires within
+              </InlineFormLabel>
+              <input
+                type="text"
+                className="gf-form-input"
+                placeholder="720h"
+                value={expiresWithin}
+                onChange={this.onExpiresWithinChange}
+                onBlur={this.onRunQuery}
+              />
+            </div>
+          ) : null}
+          {configEntries ? (
+            <div className="gf-form">
+              <InlineFormLabel width={7} tooltip="Kind of the config entries. Each kind is returned as its own table.">
+                Kind
+              </InlineFormLabel>
+              <Select
+                width={24}
+                isSearchable={false}
+                options={KIND_OPTIONS}
+                onChange={this.onKindChange}
+                value={kindOption}
+              />
+            </div>
+          ) : null}
+          {members ? (
+            <div className="gf-form">
+              <InlineFormLabel width={7} tooltip="Gossip pool of the agent: LAN members of the datacenter or WAN members of all datacenters.">
+                Pool
+              </InlineFormLabel>
+              <Select
+                width={16}
+                isSearchable={false}
+                options={POOL_OPTIONS}
+                onChange={this.onPoolChange}
+                value={poolOption}
+              />
+            </div>
+          ) : null}
+          {!members ? (
+            <>
+            <div className="gf-form">
+              <InlineFormLabel
+                width={7}
+                tooltip="Datacenter to query. Uses the default datacenter of the data source if empty. Use * to query all datacenters, the results are labeled with their datacenter."
+              >
+                Datacenter
+              </InlineFormLabel>
+              <input
+                type="text"
+                className="gf-form-input"
+                placeholder=""
+                value={datacenter}
+                onChange={this.onDatacenterChange}
+                onBlur={this.onRunQuery}
+              />
+            </div>
+            <div className="gf-form">
+              <InlineFormLabel
+                width={7}
+                tooltip="Consul Enterprise namespace to query. Uses the default namespace of the data source if empty. Use * to query all namespaces, the results are labeled with their namespace."
+              >
+                Namespace
+              </InlineFormLabel>
+              <input
+                type="text"
+                className="gf-form-input"
+                placeholder=""
+                value={namespace}
+                onChange={this.onNamespaceChange}
+                onBlur={this.onRunQuery}
+              />
+            </div>
+            <div className="gf-form">
+              <InlineFormLabel
+                width={7}
+                tooltip="Consul Enterprise admin partition to query. Uses the default partition of the data source if empty."
+              >
+                Partition
+              </InlineFormLabel>
+              <input
+                type="text"
+                className="gf-form-input"
+                placeholder=""
+                value={partition}
+                onChange={this.onPartitionChange}
+                onBlur={this.onRunQuery}
+              />
+            </div>
+            </>
+          ) : null}
+          {typeOption.value === 'services' || typeOption.value === 'service' ? (
+            <div className="gf-form">
+              <InlineFormLabel width={7} tooltip="Comma-separated list of tags the services must have.">
+                Tags
+              </InlineFormLabel>
+              <input
+                type="text"
+                className="gf-form-input"
+                placeholder=""
+                value={tag}
+                onChange={this.onTagChange}
+                onBlur={this.onRunQuery}
+              />
+            </div>
+          ) : null}
+          {catalog || health ? (
+            <div className="gf-form">
+              <InlineFormLabel width={7} tooltip="Comma-separated list of node meta filters, e.g. rack=a,env=prod.">
+                Node meta
+              </InlineFormLabel>
+              <input
+                type="text"
+                className="gf-form-input"
+                placeholder="key=value"
+                value={nodeMeta}
+                onChange={this.onNodeMetaChange}
+                onBlur={this.onRunQuery}
+              />
+            </div>
+          ) : null}
+        </div>
       </div>
     );
   }
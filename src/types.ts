@@ -6,6 +6,52 @@ export interface ConsulQuery extends DataQuery {
   type?: string;
   legendFormat?: string;
   columns?: string;
+  live?: boolean;
+  datacenter?: string;
+  namespace?: string;
+  partition?: string;
+  tag?: string;
+  nodeMeta?: string;
+  healthFilter?: string;
+  lockPrefix?: string;
+  expiresWithin?: string;
+  pool?: string;
+  kind?: string;
+  path?: string;
+  valueFormat?: string;
+  metadata?: boolean;
+  history?: boolean;
+  alerting?: boolean;
+  seriesFormat?: string;
+  valueMappings?: string;
+  variableSource?: string;
+  regex?: string;
+  scopedVars?: Record<string, ScopedVariable>;
+}
+
+/**
+ * Variable which is interpolated by the backend, multi-value variables have a list of values
+ */
+export interface ScopedVariable {
+  value: string | string[];
+}
+
+/**
+ * Page of a list resource of the backend, next is the cursor of the next page
+ */
+export interface ResourceList {
+  items: string[];
+  next?: string;
+}
+
+/**
+ * Value resource of the backend, the value is truncated for large values
+ */
+export interface ResourceValue {
+  key: string;
+  value: string;
+  size: number;
+  truncated: boolean;
 }
 
 /**
@@ -13,6 +59,22 @@ export interface ConsulQuery extends DataQuery {
  */
 export interface MyDataSourceOptions extends DataSourceJsonData {
   consulAddr?: string;
+  datacenter?: string;
+  namespace?: string;
+  partition?: string;
+  concurrency?: number;
+  maxConcurrentQueries?: number;
+  cacheTTL?: string;
+  consistency?: string;
+  tlsAuth?: boolean;
+  tlsAuthWithCACert?: boolean;
+  tlsSkipVerify?: boolean;
+  serverName?: string;
+  historyKeys?: string;
+  historyPath?: string;
+  historyRetention?: string;
+  snapshotPath?: string;
+  snapshotEncoding?: string;
 }
 
 /**
@@ -20,4 +82,9 @@ export interface MyDataSourceOptions extends DataSourceJsonData {
  */
 export interface MySecureJsonData {
   consulToken?: string;
+  tlsCACert?: string;
+  tlsClientCert?: string;
+  tlsClientKey?: string;
 }
+
+export type TLSSecureJsonKey = 'tlsCACert' | 'tlsClientCert' | 'tlsClientKey';